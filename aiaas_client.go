@@ -9,19 +9,19 @@ import (
 	"time"
 )
 
-func (c *client) buildAIaaSHeader(body []byte) (header map[string]string) {
+func (c *client) buildAIaaSHeader(host string, body []byte) (header map[string]string) {
 	header = make(map[string]string)
 	//date必须是utc时区，且不能和服务器时间相差300s
 	currentTime := time.Now().UTC().Format(time.RFC1123)
 	//对body进行sha256签名,生成digest头部，POST请求必须对body验证
 	digest := "SHA-256=" + signBody(body)
 	//根据请求头部内容，生成签名
-	sign := generateSignature(c.host, currentTime, http.MethodPost, c.uri, "HTTP/1.1", digest, c.apiSecret)
+	sign := generateSignature(host, currentTime, http.MethodPost, c.uri, "HTTP/1.1", digest, c.apiSecret)
 	//组装Authorization头部
 	authHeader := fmt.Sprintf(`hmac api_key="%s", algorithm="%s", headers="host date request-line digest", signature="%s"`, c.apikey, "hmac-sha256", sign)
 
 	header["Content-Type"] = "application/json"
-	header["Host"] = c.host
+	header["Host"] = host
 	header["Date"] = currentTime
 	header["Digest"] = digest
 	header["Authorization"] = authHeader
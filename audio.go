@@ -0,0 +1,194 @@
+package ase
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EncodingRaw = "raw" // 未压缩的pcm音频
+
+	// 以下格式仅用于输入, 发送前需通过 ConvertAudio 或 AudioSourceConfig.Target 转换为pcm
+	EncodingFloat = "float" // 小端IEEE浮点采样
+	EncodingMuLaw = "ulaw"  // G.711 μ-law
+	EncodingALaw  = "alaw"  // G.711 A-law
+)
+
+// AudioFormat 音频格式参数, 与 AudioPayload 中的同名字段对应
+type AudioFormat struct {
+	Encoding   string
+	SampleRate int
+	Channels   int
+	BitDepth   int
+}
+
+// BytesPerSecond 每秒音频的字节数, 非pcm格式返回0
+func (f AudioFormat) BytesPerSecond() int {
+	if !f.IsPCM() {
+		return 0
+	}
+	return f.SampleRate * f.Channels * f.BitDepth / 8
+}
+
+// Duration 计算n字节音频的时长, 非pcm格式返回0
+func (f AudioFormat) Duration(n int) time.Duration {
+	bps := f.BytesPerSecond()
+	if bps <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second / time.Duration(bps)
+}
+
+// Bytes 计算时长d的音频字节数, 按帧(所有声道的一个采样)对齐
+func (f AudioFormat) Bytes(d time.Duration) int {
+	block := f.Channels * f.BitDepth / 8
+	if block <= 0 || f.SampleRate <= 0 {
+		return 0
+	}
+	return int(d*time.Duration(f.SampleRate)/time.Second) * block
+}
+
+// IsPCM 是否为未压缩的pcm音频
+func (f AudioFormat) IsPCM() bool {
+	return (f.Encoding == "" || f.Encoding == EncodingRaw) && f.SampleRate > 0 && f.Channels > 0 && f.BitDepth > 0
+}
+
+// frameAudioDuration 计算一帧请求中携带的音频时长, 音频不是pcm格式导致无法计算时ok为false
+func frameAudioDuration(v interface{}) (d time.Duration, ok bool) {
+	switch req := v.(type) {
+	case *Request:
+		ok = true
+		for _, p := range req.Payload {
+			format, audio, found := audioOf(p)
+			if !found {
+				continue
+			}
+			if !format.IsPCM() {
+				ok = false
+				continue
+			}
+			if n := format.Duration(base64DecodedLen(audio)); n > d {
+				d = n
+			}
+		}
+		return
+	case *AIaaSRequest:
+		audio, found := req.Data["audio"].(string)
+		if !found {
+			return 0, true
+		}
+		format, _ := req.Data["format"].(string)
+		f := parseAIaaSFormat(format)
+		return f.Duration(base64DecodedLen(audio)), f.IsPCM()
+	}
+
+	return 0, true
+}
+
+// audioOf 从payload中取出音频格式与base64编码的音频数据
+func audioOf(p interface{}) (format AudioFormat, audio string, ok bool) {
+	switch a := p.(type) {
+	case *AudioPayload:
+		if a == nil {
+			return
+		}
+		return AudioFormat{Encoding: a.Encoding, SampleRate: a.SampleRate, Channels: a.Channels, BitDepth: a.BitDepth}, a.Audio, true
+	case AudioPayload:
+		return audioOf(&a)
+	case map[string]interface{}:
+		if audio, ok = a["audio"].(string); !ok {
+			return
+		}
+		format.Encoding, _ = a["encoding"].(string)
+		format.SampleRate = toInt(a["sample_rate"])
+		format.Channels = toInt(a["channels"])
+		format.BitDepth = toInt(a["bit_depth"])
+		return
+	}
+
+	return
+}
+
+// parseAIaaSFormat 解析AIaaS协议中形如 audio/L16;rate=16000 的音频格式
+func parseAIaaSFormat(s string) (f AudioFormat) {
+	f.Channels = 1
+	for i, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if i == 0 {
+			if strings.HasPrefix(part, "audio/L") {
+				f.BitDepth, _ = strconv.Atoi(strings.TrimPrefix(part, "audio/L"))
+			}
+			continue
+		}
+		if rate, found := strings.CutPrefix(part, "rate="); found {
+			f.SampleRate, _ = strconv.Atoi(rate)
+		}
+	}
+	return
+}
+
+func base64DecodedLen(s string) int {
+	n := len(s) / 4 * 3
+	if strings.HasSuffix(s, "==") {
+		return n - 2
+	}
+	if strings.HasSuffix(s, "=") {
+		return n - 1
+	}
+	return n
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case float32:
+		return int(n)
+	case interface{ Int64() (int64, error) }:
+		i, _ := n.Int64()
+		return int(i)
+	}
+	return 0
+}
+
+// pcmLevel 计算一段小端pcm音频的均方根电平, 按满量程归一化到[0, 1]
+func pcmLevel(pcm []byte, f AudioFormat) float64 {
+	width := f.BitDepth / 8
+	if width <= 0 || len(pcm) < width {
+		return 0
+	}
+
+	var sum float64
+	n := len(pcm) / width
+	for i := 0; i < n; i++ {
+		v := pcmSample(pcm[i*width:], width)
+		sum += v * v
+	}
+
+	return math.Sqrt(sum / float64(n))
+}
+
+// pcmSample 读取一个小端有符号采样, 归一化到[-1, 1); 8bit音频按无符号处理
+func pcmSample(b []byte, width int) float64 {
+	switch width {
+	case 1:
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / 32768
+	case 3:
+		v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+		return float64(v) / 8388608
+	case 4:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648
+	}
+	return 0
+}
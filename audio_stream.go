@@ -0,0 +1,445 @@
+package ase
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAudioPayloadKey  = "audio"
+	defaultFrameSize        = 1280 // 16k采样率 16bit 单声道 40ms
+	defaultFrameDuration    = 40 * time.Millisecond
+	defaultSilenceThreshold = 0.01 // 约-40dBFS
+)
+
+// AudioStreamConfig 音频流配置
+type AudioStreamConfig struct {
+	Header     RequestHeader          // 平台参数, status 由音频流维护, 未设置 app_id 时使用客户端的appid
+	Parameter  map[string]interface{} // 服务参数, 每个会话的首帧都会携带
+	PayloadKey string                 // 音频数据的payload key, 默认 audio
+	Format     AudioFormat            // 音频格式, 仅支持pcm
+	FrameSize  int                    // 每帧音频的字节数, 默认1280
+
+	// MaxSessionDuration 单个会话允许的最长音频时长, 为0时不切换会话
+	MaxSessionDuration time.Duration
+	// RolloverWindow 距离时长上限多久开始在静音处切换会话, 默认为 MaxSessionDuration 的十分之一
+	RolloverWindow time.Duration
+	// SilenceThreshold 静音判定的电平阈值, 按满量程归一化, 默认0.01
+	SilenceThreshold float64
+}
+
+// AudioStream 长音频流.
+// 单个会话的音频时长接近上限时, 在静音处结束当前会话(发送 StatusLastFrame)并以相同参数开启新会话,
+// 各会话的结果按顺序拼接, 时间戳平移为整个音频流上的绝对时间.
+type AudioStream struct {
+	factory SessionFactory
+	cfg     AudioStreamConfig
+	codec   TimestampCodec
+	log     *slog.Logger
+	uri     string
+
+	// sendMu 串行化 Write 与 Close, 发送期间不持有mu, Destroy 与 Stats 不会被阻塞的发送卡住
+	sendMu sync.Mutex
+	cur    *streamSession
+	buf    []byte
+	offset time.Duration // 已发送音频的总时长
+
+	mu       sync.Mutex
+	started  *sync.Cond // 开启新会话或音频流结束时通知 merge
+	sessions []*streamSession
+	closed   bool
+
+	results chan streamResult
+	done    chan struct{}
+	once    sync.Once
+}
+
+type streamSession struct {
+	cli   ASE
+	start time.Duration // 会话首帧在音频流中的偏移
+	sent  time.Duration
+	seq   int
+	msgs  chan streamResult
+
+	mu     sync.Mutex
+	rolled bool // 会话因时长上限被结束, 其尾帧结果不是整个音频流的结束
+}
+
+type streamResult struct {
+	msg []byte
+	err error
+}
+
+// NewAudioStream 创建音频流, 每个会话由cli创建并使用独立的连接.
+// cli通常是 NewClient 返回的客户端(仅作为模板)或 ConnPool, 时间戳按其 WithTimestampCodec 平移
+func NewAudioStream(cli SessionFactory, cfg AudioStreamConfig) (*AudioStream, error) {
+	if cli == nil {
+		return nil, fmt.Errorf("nil session factory")
+	}
+
+	if !cfg.Format.IsPCM() {
+		return nil, fmt.Errorf("unsupported audio format: %+v", cfg.Format)
+	}
+
+	if cfg.PayloadKey == "" {
+		cfg.PayloadKey = defaultAudioPayloadKey
+	}
+	if cfg.FrameSize <= 0 {
+		cfg.FrameSize = defaultFrameSize
+	}
+	if cfg.RolloverWindow <= 0 {
+		cfg.RolloverWindow = cfg.MaxSessionDuration / 10
+	}
+	if cfg.SilenceThreshold <= 0 {
+		cfg.SilenceThreshold = defaultSilenceThreshold
+	}
+
+	s := &AudioStream{
+		factory: cli,
+		cfg:     cfg,
+		codec:   ASETimestampCodec{},
+		log:     slog.New(discardHandler{}),
+		results: make(chan streamResult, 64),
+		done:    make(chan struct{}),
+	}
+	s.started = sync.NewCond(&s.mu)
+
+	header := RequestHeader{}
+	for k, v := range cfg.Header {
+		header[k] = v
+	}
+	if tmpl := templateOf(cli); tmpl != nil {
+		if _, ok := header["app_id"]; !ok {
+			header.SetAppID(tmpl.appid)
+		}
+		s.codec, s.log, s.uri = tmpl.codec, tmpl.log, tmpl.uri
+	}
+	s.cfg.Header = header
+
+	go s.merge()
+
+	return s, nil
+}
+
+// Write 写入pcm音频, 按 FrameSize 分帧发送
+func (s *AudioStream) Write(pcm []byte) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.isClosed() {
+		return ErrStreamClosed
+	}
+
+	s.buf = append(s.buf, pcm...)
+	for len(s.buf) >= s.cfg.FrameSize {
+		frame := s.buf[:s.cfg.FrameSize]
+		if err := s.sendFrame(frame, StatusContinue); err != nil {
+			return err
+		}
+		s.buf = s.buf[s.cfg.FrameSize:]
+	}
+
+	return nil
+}
+
+// Close 发送剩余音频并结束音频流, 之后仍需通过 Receive 读取剩余结果
+func (s *AudioStream) Close() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.isClosed() {
+		return nil
+	}
+
+	err := s.sendFrame(s.buf, StatusLastFrame)
+	s.buf = nil
+
+	s.mu.Lock()
+	s.closed = true
+	s.started.Broadcast()
+	s.mu.Unlock()
+
+	return err
+}
+
+func (s *AudioStream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// Receive 按顺序读取各会话的结果, 所有结果读取完毕后返回 io.EOF
+func (s *AudioStream) Receive() ([]byte, error) {
+	r, ok := <-s.results
+	if !ok {
+		return nil, io.EOF
+	}
+	return r.msg, r.err
+}
+
+// Destroy 关闭所有会话的连接, 阻塞中的 Write 与 Close 随之返回
+func (s *AudioStream) Destroy() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+
+	s.mu.Lock()
+	s.closed = true
+	s.started.Broadcast()
+	sessions := s.sessions
+	s.mu.Unlock()
+
+	var err error
+	for _, sess := range sessions {
+		if e := sess.cli.Destroy(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Stats 按顺序返回各会话的统计, 会话未实现 StatsReporter 时为零值
+func (s *AudioStream) Stats() []StreamStats {
+	s.mu.Lock()
+	sessions := s.sessions
+	s.mu.Unlock()
+
+	res := make([]StreamStats, len(sessions))
+	for i, sess := range sessions {
+		if r, ok := sess.cli.(StatsReporter); ok {
+			res[i] = r.Stats()
+		}
+	}
+	return res
+}
+
+// sendFrame 发送一帧音频, 需要时先切换会话. 调用方需持有sendMu
+func (s *AudioStream) sendFrame(frame []byte, status int) error {
+	d := s.cfg.Format.Duration(len(frame))
+
+	if s.cur != nil && status != StatusLastFrame && s.shouldRollover(frame, d) {
+		if err := s.rollover(); err != nil {
+			return err
+		}
+	}
+
+	if s.cur == nil {
+		if err := s.startSession(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.cur.send(s, frame, status); err != nil {
+		return err
+	}
+
+	s.cur.sent += d
+	s.offset += d
+	return nil
+}
+
+func (s *AudioStream) shouldRollover(frame []byte, d time.Duration) bool {
+	limit := s.cfg.MaxSessionDuration
+	if limit <= 0 {
+		return false
+	}
+
+	next := s.cur.sent + d
+	if next > limit {
+		return true
+	}
+
+	return next > limit-s.cfg.RolloverWindow && pcmLevel(frame, s.cfg.Format) < s.cfg.SilenceThreshold
+}
+
+// rollover 结束当前会话, 下一帧将在新会话上以首帧发送
+func (s *AudioStream) rollover() error {
+	sess := s.cur
+	sess.mu.Lock()
+	sess.rolled = true
+	sess.mu.Unlock()
+
+	s.log.Info("ase stream rollover", "uri", s.uri, "offset", s.offset, "session_duration", sess.sent)
+
+	s.cur = nil
+	return sess.send(s, nil, StatusLastFrame)
+}
+
+// startSession 开启新会话, 调用方需持有sendMu
+func (s *AudioStream) startSession() error {
+	sess := &streamSession{
+		cli:   s.factory.Session(),
+		start: s.offset,
+		msgs:  make(chan streamResult, 64),
+	}
+
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		// Destroy 已经关闭了已有的会话, 不再开启新会话
+		s.mu.Unlock()
+		_ = sess.cli.Destroy()
+		return ErrStreamClosed
+	default:
+	}
+	s.sessions = append(s.sessions, sess)
+	s.started.Broadcast()
+	s.mu.Unlock()
+
+	s.cur = sess
+	go sess.receive(s.codec, s.done)
+	return nil
+}
+
+func (sess *streamSession) send(s *AudioStream, frame []byte, status int) error {
+	if sess.seq == 0 {
+		if status == StatusLastFrame {
+			// 会话只有一帧时先以首帧发送音频, 再单独发送尾帧
+			if err := sess.send(s, frame, StatusFirstFrame); err != nil {
+				return err
+			}
+			return sess.send(s, nil, StatusLastFrame)
+		}
+		status = StatusFirstFrame
+	}
+	sess.seq++
+
+	header := RequestHeader{}
+	for k, v := range s.cfg.Header {
+		header[k] = v
+	}
+	header.SetStatus(status)
+
+	req := new(Request)
+	req.SetHeaders(header)
+	if sess.seq == 1 {
+		req.SetParameters(s.cfg.Parameter)
+	}
+	req.SetAudioPayload(s.cfg.PayloadKey, &AudioPayload{
+		Encoding:   EncodingRaw,
+		SampleRate: s.cfg.Format.SampleRate,
+		Channels:   s.cfg.Format.Channels,
+		BitDepth:   s.cfg.Format.BitDepth,
+		Status:     status,
+		Seq:        sess.seq,
+		Audio:      base64.StdEncoding.EncodeToString(frame),
+		FrameSize:  s.cfg.FrameSize,
+	})
+
+	return sess.cli.Send(req)
+}
+
+// receive 读取会话结果并平移时间戳, 直到会话结束
+func (sess *streamSession) receive(codec TimestampCodec, done <-chan struct{}) {
+	defer close(sess.msgs)
+
+	emit := func(r streamResult) bool {
+		select {
+		case sess.msgs <- r:
+			return r.err == nil
+		case <-done:
+			return false
+		}
+	}
+
+	for {
+		msg, err := sess.cli.Receive()
+		if err == nil {
+			err = codeErr(msg)
+		}
+		if err != nil {
+			emit(streamResult{err: err})
+			return
+		}
+
+		if len(msg) == 0 {
+			continue
+		}
+
+		if msg, err = codec.Shift(msg, sess.start); err != nil {
+			emit(streamResult{err: err})
+			return
+		}
+
+		status, _ := peekStatus(msg)
+		if status != StatusLastFrame {
+			if !emit(streamResult{msg: msg}) {
+				return
+			}
+			continue
+		}
+
+		sess.mu.Lock()
+		rolled := sess.rolled
+		sess.mu.Unlock()
+
+		if rolled {
+			msg, err = setHeaderStatus(msg, StatusContinue)
+		}
+		emit(streamResult{msg: msg, err: err})
+		_ = sess.cli.Destroy()
+		return
+	}
+}
+
+// merge 按会话顺序转发结果, 出错后丢弃剩余结果
+func (s *AudioStream) merge() {
+	defer close(s.results)
+
+	failed := false
+	for i := 0; ; i++ {
+		sess := s.session(i)
+		if sess == nil {
+			return
+		}
+
+		for r := range sess.msgs {
+			if failed {
+				continue
+			}
+
+			select {
+			case s.results <- r:
+			case <-s.done:
+				failed = true
+			}
+			failed = failed || r.err != nil
+		}
+	}
+}
+
+// session 等待并返回第i个会话, 音频流结束且没有更多会话时返回nil
+func (s *AudioStream) session(i int) *streamSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i >= len(s.sessions) && !s.closed {
+		s.started.Wait()
+	}
+	if i < len(s.sessions) {
+		return s.sessions[i]
+	}
+	return nil
+}
+
+// setHeaderStatus 改写结果中的 header.status
+func setHeaderStatus(msg []byte, status int) ([]byte, error) {
+	doc, err := decodeDoc(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	header, ok := doc["header"].(map[string]interface{})
+	if !ok {
+		return msg, nil
+	}
+	header["status"] = status
+
+	return json.Marshal(doc)
+}
@@ -0,0 +1,195 @@
+package ase
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sessionFunc 以函数实现 SessionFactory
+type sessionFunc func() ASE
+
+func (f sessionFunc) Session() ASE { return f() }
+
+// lastFrameServer 在收到尾帧后返回一个结束结果并关闭连接
+func lastFrameServer(conn *websocket.Conn) {
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if status, ok := peekStatus(msg); ok && status == StatusLastFrame {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"header":{"code":0,"status":2}}`))
+			drain(conn)
+			return
+		}
+	}
+}
+
+// 会话数超过内部缓冲区且调用方尚未读取结果时 Write 不能阻塞
+func TestAudioStreamManySessions(t *testing.T) {
+	s := newTestServer(t, lastFrameServer)
+	tmpl := newTestClient(t, s, "/audio-stream")
+
+	const sessions = 100
+	stream, err := NewAudioStream(sessionFunc(tmpl.Session), AudioStreamConfig{
+		Parameter:          map[string]interface{}{"engine": map[string]interface{}{"lang": "cn"}},
+		Format:             AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 1, BitDepth: 16},
+		MaxSessionDuration: defaultFrameDuration,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Destroy()
+
+	written := make(chan error, 1)
+	go func() {
+		for i := 0; i < sessions; i++ {
+			if err := stream.Write(make([]byte, defaultFrameSize)); err != nil {
+				written <- err
+				return
+			}
+		}
+		written <- stream.Close()
+	}()
+
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Write blocked")
+	}
+
+	var statuses []int
+	for {
+		msg, err := stream.Receive()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var resp struct {
+			Header struct {
+				Status int `json:"status"`
+			} `json:"header"`
+		}
+		if err := json.Unmarshal(msg, &resp); err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, resp.Header.Status)
+	}
+
+	if len(statuses) != sessions {
+		t.Fatalf("got %d results, want %d", len(statuses), sessions)
+	}
+	for i, status := range statuses {
+		want := StatusContinue
+		if i == sessions-1 {
+			want = StatusLastFrame
+		}
+		if status != want {
+			t.Fatalf("result %d status = %d, want %d", i, status, want)
+		}
+	}
+	if n := len(stream.Stats()); n != sessions {
+		t.Fatalf("stats of %d sessions, want %d", n, sessions)
+	}
+}
+
+func TestAudioStreamEngineError(t *testing.T) {
+	s := newTestServer(t, func(conn *websocket.Conn) {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"header":{"code":10001,"message":"bad","status":2}}`))
+		drain(conn)
+	})
+
+	stream, err := NewAudioStream(newTestClient(t, s, "/audio-stream-error"), AudioStreamConfig{
+		Parameter: map[string]interface{}{"engine": map[string]interface{}{"lang": "cn"}},
+		Format:    AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 1, BitDepth: 16},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Destroy()
+
+	if err := stream.Write(make([]byte, defaultFrameSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = stream.Receive()
+	ee, ok := err.(*EngineError)
+	if !ok || ee.Code != 10001 {
+		t.Fatalf("err = %v, want engine error 10001", err)
+	}
+}
+
+// blockingASE 的 Send 与 Receive 一直阻塞到 Destroy
+type blockingASE struct {
+	recordingASE
+	sending   chan struct{}
+	destroyed chan struct{}
+	once      sync.Once
+}
+
+func (b *blockingASE) Send(*Request) error {
+	close(b.sending)
+	<-b.destroyed
+	return ErrStreamClosed
+}
+
+func (b *blockingASE) Receive() ([]byte, error) {
+	<-b.destroyed
+	return nil, ErrStreamClosed
+}
+
+func (b *blockingASE) Destroy() error {
+	b.once.Do(func() { close(b.destroyed) })
+	return nil
+}
+
+// 阻塞在发送上的 Write 不能卡住 Destroy 与 Stats
+func TestAudioStreamDestroyDuringWrite(t *testing.T) {
+	sess := &blockingASE{sending: make(chan struct{}), destroyed: make(chan struct{})}
+	stream, err := NewAudioStream(sessionFunc(func() ASE { return sess }), AudioStreamConfig{
+		Format: AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 1, BitDepth: 16},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written := make(chan error, 1)
+	go func() { written <- stream.Write(make([]byte, defaultFrameSize)) }()
+	<-sess.sending
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if n := len(stream.Stats()); n != 1 {
+			t.Errorf("stats of %d sessions, want 1", n)
+		}
+		_ = stream.Destroy()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Destroy blocked by a pending Write")
+	}
+	if err := <-written; err != ErrStreamClosed {
+		t.Fatalf("Write err = %v, want ErrStreamClosed", err)
+	}
+	if err := stream.Write(make([]byte, defaultFrameSize)); err != ErrStreamClosed {
+		t.Fatalf("Write after Destroy err = %v", err)
+	}
+}
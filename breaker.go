@@ -0,0 +1,193 @@
+package ase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerWindow      = time.Minute
+	defaultBreakerMinRequests = 10
+	defaultBreakerCooldown    = 30 * time.Second
+)
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	ConsecutiveFailures int           // 连续失败次数达到该值时熔断, 为0时不按连续失败熔断
+	FailureRatio        float64       // 统计窗口内失败率达到该值时熔断, 为0时不按失败率熔断
+	Window              time.Duration // 失败率的统计窗口, 默认1分钟
+	MinRequests         int           // 窗口内请求数不少于该值时才按失败率熔断, 默认10
+	Cooldown            time.Duration // 熔断后经过该时间进入半开状态并放行一个探测请求, 默认30秒
+}
+
+// WithCircuitBreaker 为 Once 调用与websocket建连开启熔断, 同一host和uri的所有客户端共享同一熔断器,
+// 熔断器的配置以最先向该host和uri发起请求的客户端为准.
+// 网络错误与5xx状态码计为失败; 熔断期间请求直接返回 ErrCircuitOpen
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(c *client) {
+		if cfg.Window <= 0 {
+			cfg.Window = defaultBreakerWindow
+		}
+		if cfg.MinRequests <= 0 {
+			cfg.MinRequests = defaultBreakerMinRequests
+		}
+		if cfg.Cooldown <= 0 {
+			cfg.Cooldown = defaultBreakerCooldown
+		}
+		c.breakerCfg = &cfg
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var breakers = struct {
+	sync.Mutex
+	m map[string]*breaker
+}{
+	m: make(map[string]*breaker),
+}
+
+// breakerFor 取出host和uri对应的熔断器, 未开启熔断时返回nil
+func (c *client) breakerFor(host string) *breaker {
+	if c.breakerCfg == nil {
+		return nil
+	}
+
+	key := host + c.uri
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	b, ok := breakers.m[key]
+	if !ok {
+		b = &breaker{key: key, cfg: *c.breakerCfg}
+		breakers.m[key] = b
+	}
+
+	return b
+}
+
+type breaker struct {
+	key string
+	cfg BreakerConfig // 创建后不再修改
+
+	mu          sync.Mutex
+	state       breakerState
+	openedAt    time.Time
+	probing     bool
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+}
+
+// allow 判断请求是否可以发送, 请求结束后需调用done报告结果
+func (b *breaker) allow() (done func(err error), err error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.cfg.Cooldown {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, b.key)
+		}
+		b.state = breakerHalfOpen
+		b.probing = false
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, b.key)
+		}
+		b.probing = true
+	}
+
+	return b.report, nil
+}
+
+func (b *breaker) report(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// 调用方主动取消的请求不计入统计
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return
+	}
+
+	failed := isBreakerFailure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.trip(now)
+		} else {
+			b.reset(now)
+		}
+		return
+	}
+
+	if now.Sub(b.windowStart) > b.cfg.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+
+	if !failed {
+		b.consecutive = 0
+		return
+	}
+
+	b.consecutive++
+	b.failures++
+
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		b.trip(now)
+		return
+	}
+
+	if b.cfg.FailureRatio > 0 && b.requests >= b.cfg.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= b.cfg.FailureRatio {
+		b.trip(now)
+	}
+}
+
+func (b *breaker) trip(now time.Time) {
+	b.state = breakerOpen
+	b.openedAt = now
+}
+
+func (b *breaker) reset(now time.Time) {
+	b.state = breakerClosed
+	b.consecutive = 0
+	b.windowStart, b.requests, b.failures = now, 0, 0
+}
+
+// isBreakerFailure 网络错误与服务端5xx错误视为服务不可用
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.StatusCode >= http.StatusInternalServerError
+	}
+
+	return true
+}
@@ -0,0 +1,44 @@
+package ase
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 共享同一host和uri的客户端并发请求时, 熔断器使用最先创建它的客户端的配置
+func TestBreakerSharedConfig(t *testing.T) {
+	uri := fmt.Sprintf("/%s/%d", t.Name(), time.Now().UnixNano())
+	first := &client{uri: uri, breakerCfg: &BreakerConfig{ConsecutiveFailures: 2, Cooldown: defaultBreakerCooldown}}
+	second := &client{uri: uri, breakerCfg: &BreakerConfig{ConsecutiveFailures: 100, Cooldown: defaultBreakerCooldown}}
+
+	b := first.breakerFor("host")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if second.breakerFor("host") != b {
+				t.Error("breaker is not shared")
+			}
+		}()
+	}
+	wg.Wait()
+
+	fail := &HTTPError{StatusCode: http.StatusBadGateway}
+	for i := 0; i < 2; i++ {
+		done, err := second.breakerFor("host").allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(fail)
+	}
+
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen after 2 failures", err)
+	}
+}
@@ -1,12 +1,14 @@
 package ase
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"hash"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"sync"
@@ -14,8 +16,17 @@ import (
 
 	"github.com/go-resty/resty/v2"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ASE is the client of ASE server.
+//
+// Concurrency: Once, OnceAIaaS and their Context variants (see ContextCaller) are safe for concurrent use.
+// Send and SendAIaaS may be called from multiple goroutines, frames are written to the
+// connection one at a time in the order the calls acquire the connection.
+// Receive must be called from a single goroutine, it may run concurrently with Send.
+// Destroy may be called from any goroutine, pending Send and Receive return errors afterward.
 type ASE interface {
 	// Once send a http request to ASE server, and return the response
 	Once(data *Request) (body []byte, err error)
@@ -31,12 +42,63 @@ type ASE interface {
 	Destroy() error
 }
 
+// ContextCaller is implemented by the client returned by NewClient.
+type ContextCaller interface {
+	// OnceContext is like Once, ctx bounds the time spent waiting for rate limits
+	OnceContext(ctx context.Context, data *Request) (body []byte, err error)
+	// OnceAIaaSContext is like OnceAIaaS, ctx bounds the time spent waiting for rate limits
+	OnceAIaaSContext(ctx context.Context, data *AIaaSRequest) (body []byte, err error)
+}
+
+// StatsReporter is implemented by the client returned by NewClient.
+type StatsReporter interface {
+	// Stats return the statistics of the stream session
+	Stats() StreamStats
+}
+
+// SessionFactory is implemented by the client returned by NewClient and by ConnPool.
+// Wrappers of the client can implement it to be used with NewConnPool and NewAudioStream.
+type SessionFactory interface {
+	// Session return a new stream session with the same configuration
+	Session() ASE
+}
+
+// Runner is implemented by the client returned by NewClient.
+type Runner interface {
+	// Run send all frames of source and dispatch the results to handler, see StreamHandler
+	Run(ctx context.Context, source Source, handler StreamHandler) error
+}
+
+// Connector is implemented by the client returned by NewClient.
+type Connector interface {
+	// Connect dial the websocket connection, it's dialed lazily by Send or Receive if not called
+	Connect(ctx context.Context) error
+}
+
 type client struct {
 	appid, apikey, apiSecret string
 	host                     string // eg: iflytek.com
 	tls                      bool
 	uri                      string           // eg: /ase/v1/ping
 	signAlg                  func() hash.Hash // hash algorithm using for signature
+	codec                    TimestampCodec   // 结果时间戳的解析与平移, 默认 ASETimestampCodec
+	limiter                  *rateLimiter     // Once 与建连的限速, 默认无
+	sessionLimiter           *sessionLimiter  // 并发会话数限制, 默认无
+	breakerCfg               *BreakerConfig   // 熔断配置, 默认无
+	endpoints                *endpointSet     // 服务地址列表, 默认仅有host
+	hedger                   *hedger          // Once 的对冲请求, 默认关闭
+	log                      *slog.Logger     // 日志, 默认不输出
+	checkCode                bool             // 错误码非0时返回 *EngineError, 默认关闭
+	skipValidation           bool             // 不校验流式请求帧, 默认校验
+	reorderCfg               *ReorderConfig   // 按seq重排结果, 默认关闭
+
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	tel            *telemetry
+
+	onceInterceptors    []OnceInterceptor
+	sendInterceptors    []SendInterceptor
+	receiveInterceptors []ReceiveInterceptor
 
 	*onceCaller
 	*streamCaller
@@ -72,6 +134,24 @@ func NewClient(appid, apikey, apiSecret, host, uri string, opts ...Option) (ASE,
 		c.signAlg = sha256.New
 	}
 
+	if c.codec == nil {
+		c.codec = ASETimestampCodec{}
+	}
+
+	if c.log == nil {
+		c.log = slog.New(discardHandler{})
+	}
+
+	c.tel = newTelemetry(c.tracerProvider, c.meterProvider)
+
+	if c.endpoints == nil {
+		c.endpoints = newEndpointSet()
+	}
+	if len(c.endpoints.list) == 0 {
+		c.endpoints.setEndpoints([]Endpoint{{Host: host}})
+	}
+	c.host = c.endpoints.primary()
+
 	return c, nil
 }
 
@@ -131,6 +211,13 @@ func WithStreamDialHeader(header http.Header) Option {
 	}
 }
 
+// WithTimestampCodec 设置识别结果时间戳的解析方式, 用于断线续传等需要改写时间戳的场景
+func WithTimestampCodec(codec TimestampCodec) Option {
+	return func(c *client) {
+		c.codec = codec
+	}
+}
+
 type onceCaller struct {
 	cli *resty.Client
 }
@@ -138,111 +225,544 @@ type onceCaller struct {
 type streamCaller struct {
 	conn             *websocket.Conn
 	connTimeout      time.Duration // 连接保活时间, 默认无
+	pingInterval     time.Duration // ping间隔, 默认不发送
+	pongTimeout      time.Duration // 等待pong的超时时间, 默认不检测
 	handshakeTimeout time.Duration // 握手超时时间, 默认无
 	readTimeout      time.Duration
 	writeTimeout     time.Duration
 	streamDialHeader http.Header
+	resume           *resumer // 断线续传, 默认关闭
+	release          func()   // 释放并发会话名额
+	trace            *streamTrace
+	stats            sessionStats
+	end              streamEnd
+	frames           frameState
+	reorder          *reorderer
+
+	queueSize   int // 异步发送队列的容量, 为0时同步发送
+	queuePolicy OverflowPolicy
+	onDrop      func(req interface{})
+	queue       *sendQueue
+
+	mu         sync.Mutex // 保护 conn、server、queue、release、trace、cancelDial 与 closed
+	server     string     // 当前连接的服务地址, 切换地址或断线重连后更新
+	closed     bool       // 已调用 Destroy, 之后不再建连
+	cancelDial context.CancelFunc
+
+	sendMu  sync.Mutex // 串行化 Send 的校验与写入(或入队)
+	writeMu sync.Mutex // websocket连接同一时刻只允许一个写入者
+	watchMu sync.Mutex
+	watches map[*websocket.Conn]*keepalive
 
 	once    sync.Once
 	onceErr error
 }
 
+// clone 复制客户端配置, 返回一个尚未建连的新流式会话
+func (c *client) clone() *client {
+	return &client{
+		appid:          c.appid,
+		apikey:         c.apikey,
+		apiSecret:      c.apiSecret,
+		host:           c.host,
+		tls:            c.tls,
+		uri:            c.uri,
+		signAlg:        c.signAlg,
+		codec:          c.codec,
+		limiter:        c.limiter,
+		sessionLimiter: c.sessionLimiter,
+		breakerCfg:     c.breakerCfg,
+		endpoints:      c.endpoints,
+		hedger:         c.hedger,
+		log:            c.log,
+		checkCode:      c.checkCode,
+		skipValidation: c.skipValidation,
+		reorderCfg:     c.reorderCfg,
+
+		tracerProvider: c.tracerProvider,
+		meterProvider:  c.meterProvider,
+		tel:            c.tel,
+
+		onceInterceptors:    c.onceInterceptors,
+		sendInterceptors:    c.sendInterceptors,
+		receiveInterceptors: c.receiveInterceptors,
+
+		onceCaller:   c.onceCaller,
+		streamCaller: c.streamCaller.clone(),
+	}
+}
+
+func (s *streamCaller) clone() *streamCaller {
+	return &streamCaller{
+		connTimeout:      s.connTimeout,
+		pingInterval:     s.pingInterval,
+		pongTimeout:      s.pongTimeout,
+		handshakeTimeout: s.handshakeTimeout,
+		readTimeout:      s.readTimeout,
+		writeTimeout:     s.writeTimeout,
+		streamDialHeader: s.streamDialHeader,
+		resume:           s.resume.clone(),
+		queueSize:        s.queueSize,
+		queuePolicy:      s.queuePolicy,
+		onDrop:           s.onDrop,
+	}
+}
+
 func (c *client) Once(data *Request) (resp []byte, err error) {
+	return c.OnceContext(context.Background(), data)
+}
+
+func (c *client) OnceContext(ctx context.Context, data *Request) (resp []byte, err error) {
+	ctx, end := c.traceOnce(ctx, "ase.Once")
+	defer func() {
+		end(resp, err)
+	}()
+
+	return c.invokeOnce(ctx, data)
+}
+
+func (c *client) postOnce(ctx context.Context, host string, data *Request) (resp []byte, err error) {
 	var (
 		res *resty.Response
 	)
 
+	start := time.Now()
+	defer func() {
+		c.logOnce(ctx, host, start, resp, err)
+	}()
+
+	done, err := c.breakerFor(host).allow()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		done(err)
+	}()
+
+	if err = c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	traceAttempt(ctx, host)
 	res, err = c.cli.R().
+		SetContext(ctx).
+		SetHeaderMultiValues(c.traceHeader(ctx, nil)).
 		SetHeader("Content-Type", "application/json").
 		SetBody(data).
-		Post(c.buildSignedURL(c.host, c.uri, http.MethodPost))
+		Post(c.buildSignedURL(host, c.uri, http.MethodPost))
 	if err != nil {
 		return nil, err
 	}
 
 	if res.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("http_code: %d, http_msg: %s, body: %s", res.StatusCode(), res.Status(), string(res.Body()))
+		return nil, &HTTPError{StatusCode: res.StatusCode(), Status: res.Status(), Body: res.Body()}
 	}
 
+	traceServer(ctx, host)
 	return res.Body(), nil
 }
 
 func (c *client) OnceAIaaS(data *AIaaSRequest) (resp []byte, err error) {
+	return c.OnceAIaaSContext(context.Background(), data)
+}
+
+func (c *client) OnceAIaaSContext(ctx context.Context, data *AIaaSRequest) (resp []byte, err error) {
+	ctx, end := c.traceOnce(ctx, "ase.OnceAIaaS")
+	defer func() {
+		end(resp, err)
+	}()
+
+	return c.invokeOnce(ctx, data)
+}
+
+// doOnce 在拦截器链的末端发送非流式请求
+func (c *client) doOnce(ctx context.Context, req interface{}) ([]byte, error) {
+	switch data := req.(type) {
+	case *Request:
+		return c.checkResult(c.hedge(ctx, func(ctx context.Context, offset int) ([]byte, error) {
+			return c.failoverFrom(offset, func(host string) ([]byte, error) {
+				return c.postOnce(ctx, host, data)
+			})
+		}))
+	case *AIaaSRequest:
+		body, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.checkResult(c.hedge(ctx, func(ctx context.Context, offset int) ([]byte, error) {
+			return c.failoverFrom(offset, func(host string) ([]byte, error) {
+				return c.postOnceAIaaS(ctx, host, body)
+			})
+		}))
+	}
+
+	return nil, unsupportedRequest(req)
+}
+
+func (c *client) postOnceAIaaS(ctx context.Context, host string, body []byte) (resp []byte, err error) {
 	var (
-		res  *resty.Response
-		body []byte
+		res *resty.Response
 	)
 
-	body, err = json.Marshal(data)
+	start := time.Now()
+	defer func() {
+		c.logOnce(ctx, host, start, resp, err)
+	}()
+
+	done, err := c.breakerFor(host).allow()
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		done(err)
+	}()
 
+	if err = c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	traceAttempt(ctx, host)
 	res, err = c.cli.R().
-		SetHeaders(c.buildAIaaSHeader(body)).
+		SetContext(ctx).
+		SetHeaderMultiValues(c.traceHeader(ctx, nil)).
+		SetHeaders(c.buildAIaaSHeader(host, body)).
 		SetBody(body).
-		Post(scheme(http.MethodPost, c.tls) + c.host + c.uri)
+		Post(scheme(http.MethodPost, c.tls) + host + c.uri)
 	if err != nil {
 		return nil, err
 	}
 
 	if res.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("http_code: %d, http_msg: %s, body: %s", res.StatusCode(), res.Status(), string(res.Body()))
+		return nil, &HTTPError{StatusCode: res.StatusCode(), Status: res.Status(), Body: res.Body()}
 	}
 
+	traceServer(ctx, host)
 	return res.Body(), nil
 }
 
 func (c *client) Receive() (msg []byte, err error) {
-	c.once.Do(func() {
-		c.onceErr = c.initWebsocketConn()
-	})
+	return c.invokeReceive(context.Background())
+}
 
-	if c.onceErr != nil {
-		return nil, c.onceErr
+func (c *client) Send(v *Request) (err error) {
+	return c.invokeSend(context.Background(), v)
+}
+
+func (c *client) SendAIaaS(v *AIaaSRequest) (err error) {
+	return c.invokeSend(context.Background(), v)
+}
+
+// doReceive 在拦截器链的末端接收结果
+func (c *client) doReceive(ctx context.Context) ([]byte, error) {
+	if c.reorderCfg == nil {
+		return c.receiveMsg(ctx)
 	}
 
-	if c.readTimeout > 0 {
-		_ = c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	if c.reorder == nil {
+		c.reorder = newReorderer(c.reorderCfg)
+	}
+	return c.reorder.receive(ctx, c)
+}
+
+// receiveMsg 从连接读取一条结果
+func (c *client) receiveMsg(ctx context.Context) (msg []byte, err error) {
+	if err = c.connect(ctx); err != nil {
+		return nil, err
 	}
 
-	_, msg, err = c.conn.ReadMessage()
+	if c.resume != nil {
+		msg, err = c.resume.receive(c)
+	} else {
+		msg, err = c.read(c.currentConn())
+	}
+
+	var ttfr time.Duration
+	if err == nil {
+		ttfr = c.stats.receive(msg)
+		c.end.observe(msg)
+	} else {
+		err = c.end.closeErr(err)
+	}
+
+	c.logReceive(ctx, msg, err)
+	c.traceReceive(msg, err, ttfr)
+	return c.checkResult(msg, err)
+}
+
+// doSend 在拦截器链的末端发送一帧
+func (c *client) doSend(ctx context.Context, req interface{}) (err error) {
+	switch req.(type) {
+	case *Request, *AIaaSRequest:
+	default:
+		return unsupportedRequest(req)
+	}
+
+	// 校验与写入在同一把锁中完成, 并发 Send 时帧按校验的顺序写入连接
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	var commit func()
+	if !c.skipValidation {
+		if commit, err = c.frames.check(req); err != nil {
+			c.logSend(ctx, req, err)
+			return err
+		}
+	}
+
+	if err = c.connect(ctx); err != nil {
+		return err
+	}
+
+	if c.queue != nil {
+		err = c.enqueue(req)
+	} else {
+		err = c.writeFrame(ctx, req)
+	}
+	if err == nil && commit != nil {
+		commit()
+	}
+	return err
+}
+
+// writeFrame 将一帧写入连接并记录统计
+func (c *client) writeFrame(ctx context.Context, req interface{}) (err error) {
+	err = c.write(req)
+	if err == nil {
+		c.stats.send(req)
+	}
+
+	c.logSend(ctx, req, err)
+	c.traceSend(req, err)
 	return
 }
 
-func (c *client) Send(v *Request) (err error) {
-	c.once.Do(func() {
-		c.onceErr = c.initWebsocketConn()
-	})
+func (c *client) Stats() StreamStats {
+	s := c.stats.snapshot()
 
-	if c.onceErr != nil {
-		return c.onceErr
+	c.mu.Lock()
+	queue := c.queue
+	c.mu.Unlock()
+
+	if queue != nil {
+		s.QueueDepth, s.FramesDropped = queue.metrics()
 	}
+	return s
+}
 
-	if c.writeTimeout > 0 {
-		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+func (c *client) Session() ASE {
+	return c.clone()
+}
+
+// templateOf 取出会话工厂背后的客户端, 用于读取日志、时间戳等配置; 其他实现返回nil
+func templateOf(f interface{}) *client {
+	switch v := f.(type) {
+	case *client:
+		return v
+	case *ConnPool:
+		return templateOf(v.factory)
 	}
+	return nil
+}
 
-	return c.conn.WriteJSON(v)
+func (c *client) Connect(ctx context.Context) error {
+	return c.connect(ctx)
 }
 
-func (c *client) SendAIaaS(v *AIaaSRequest) (err error) {
+// connect 首次收发时建立websocket连接
+func (c *client) connect(ctx context.Context) error {
 	c.once.Do(func() {
-		c.onceErr = c.initWebsocketConn()
+		c.onceErr = c.initWebsocketConn(ctx)
 	})
 
-	if c.onceErr != nil {
-		return c.onceErr
+	return c.onceErr
+}
+
+func (c *client) read(conn *websocket.Conn) (msg []byte, err error) {
+	if c.readTimeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+
+	if _, msg, err = conn.ReadMessage(); err != nil {
+		err = c.connErr(conn, err)
+	}
+	return
+}
+
+func (c *client) write(v interface{}) error {
+	if c.resume != nil {
+		return c.resume.send(c, v)
 	}
 
+	return c.writeConn(c.currentConn(), v)
+}
+
+// writeConn 向连接写入一帧, 多个goroutine的写入被串行化
+func (c *client) writeConn(conn *websocket.Conn, v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
 	if c.writeTimeout > 0 {
-		_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+		_ = conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	return conn.WriteJSON(v)
+}
+
+func (c *client) initWebsocketConn(ctx context.Context) (err error) {
+	ctx, t := c.startStream(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	closed := c.closed
+	if !closed {
+		c.trace, c.cancelDial = t, cancel
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		if err != nil {
+			c.recordError(t.span, err)
+			t.end()
+		}
+	}()
+	if closed {
+		return ErrStreamClosed
+	}
+
+	release, err := c.sessionLimiter.acquire(ctx)
+	if err != nil {
+		return c.closedErr(err)
+	}
+
+	start := time.Now()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		release()
+		return c.closedErr(err)
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		// Destroy 在建连期间被调用, 由这里关闭连接并释放名额
+		c.mu.Unlock()
+		_ = c.closeConn(conn)
+		release()
+		return ErrStreamClosed
 	}
+	c.conn, c.release = conn, release
+	if c.queueSize > 0 {
+		c.queue = newSendQueue(c.queueSize, c.queuePolicy)
+		go c.writeLoop(c.queue)
+	}
+	c.mu.Unlock()
+
+	c.stats.handshake(time.Since(start))
+	return nil
+}
+
+// closedErr 会话已被 Destroy 时返回 ErrStreamClosed, 否则返回err
+func (c *client) closedErr(err error) error {
+	if c.isClosed() {
+		return ErrStreamClosed
+	}
+	return err
+}
+
+func (c *client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+// currentConn 返回会话当前使用的连接, 断线续传时会被替换
+func (c *client) currentConn() *websocket.Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return c.conn.WriteJSON(v)
+	return c.conn
 }
 
-func (c *client) initWebsocketConn() error {
+// swapConn 替换会话的连接, 会话已被 Destroy 时返回false
+func (c *client) swapConn(conn *websocket.Conn) (old *websocket.Conn, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, false
+	}
+	old, c.conn = c.conn, conn
+	return old, true
+}
+
+// streamContext 流式会话的上下文, 携带会话的span
+func (c *client) streamContext() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.trace != nil {
+		return c.trace.ctx
+	}
+	return context.Background()
+}
+
+// dial 使用新的签名建立一条websocket连接并启动保活, 连接失败时切换到下一个服务地址
+func (c *client) dial(ctx context.Context) (conn *websocket.Conn, err error) {
+	var server string
+	_, err = c.failover(func(host string) ([]byte, error) {
+		var e error
+		conn, e = c.dialHost(ctx, host)
+		server = host
+		return nil, e
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.server = server
+	c.mu.Unlock()
+
+	c.watch(conn)
+	return conn, nil
+}
+
+// streamHost 返回会话实际连接的服务地址, 尚未建连时为首选地址
+func (c *client) streamHost() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.server != "" {
+		return c.server
+	}
+	return c.host
+}
+
+func (c *client) dialHost(ctx context.Context, host string) (conn *websocket.Conn, err error) {
+	done, err := c.breakerFor(host).allow()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		done(err)
+	}()
+
+	if err = c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	c.log.DebugContext(ctx, "ase dial", "host", host, "uri", c.uri)
+	defer func() {
+		if err != nil {
+			c.log.WarnContext(ctx, "ase handshake failed", "host", host, "uri", c.uri, "cost", time.Since(start), c.errAttr(err))
+			return
+		}
+		c.log.InfoContext(ctx, "ase handshake", "host", host, "uri", c.uri, "http_code", http.StatusSwitchingProtocols, "cost", time.Since(start))
+	}()
+
 	d := websocket.Dialer{
 		NetDial:           nil,
 		NetDialContext:    nil,
@@ -258,37 +778,50 @@ func (c *client) initWebsocketConn() error {
 		Jar:               nil,
 	}
 
-	var (
-		err  error
-		resp *http.Response
-	)
-
-	c.conn, resp, err = d.Dial(c.buildSignedURL(c.host, c.uri, http.MethodGet), c.streamDialHeader)
-	if err != nil {
-		return err
-	}
-
-	if resp.StatusCode != http.StatusSwitchingProtocols {
+	var resp *http.Response
+	conn, resp, err = d.DialContext(ctx, c.buildSignedURL(host, c.uri, http.MethodGet), c.traceHeader(ctx, c.streamDialHeader))
+	if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
 		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("http_code: %d, http_msg: %s, body: %s", resp.StatusCode, resp.Status, string(b))
+		_ = resp.Body.Close()
+		if conn != nil {
+			_ = conn.Close()
+		}
+		return nil, &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: b}
 	}
 
-	if c.connTimeout > 0 {
-		go func() {
-			tm := time.NewTimer(c.connTimeout)
-			defer tm.Stop()
-
-			<-tm.C
-			_ = c.conn.Close()
-		}()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	traceServer(ctx, host)
+	return conn, nil
 }
 
 func (c *client) Destroy() error {
-	if c.conn != nil {
-		return c.conn.Close()
+	c.log.Debug("ase stream destroy", "host", c.streamHost(), "uri", c.uri)
+
+	c.mu.Lock()
+	c.closed = true
+	conn, queue, release, t, cancel := c.conn, c.queue, c.release, c.trace, c.cancelDial
+	c.release = nil
+	c.mu.Unlock()
+
+	if cancel != nil {
+		// 中断进行中的建连
+		cancel()
+	}
+	if t != nil {
+		t.end()
+	}
+	if queue != nil {
+		queue.close()
+	}
+	if release != nil {
+		release()
+	}
+
+	if conn != nil {
+		return c.closeConn(conn)
 	}
 	return nil
 }
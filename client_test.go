@@ -0,0 +1,115 @@
+package ase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Destroy 与首次 Send/Receive 并发时不能有数据竞争, 建连中的连接与会话名额都要被释放
+func TestDestroyRacesFirstSendAndReceive(t *testing.T) {
+	s := newTestServer(t, drain)
+	uri := "/destroy-race"
+
+	for i := 0; i < 50; i++ {
+		c := newTestClient(t, s, uri, WithMaxConcurrentSessions(1), WithStreamSendQueue(4, OverflowBlock))
+
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_ = c.Send(testFrame(StatusFirstFrame, 1, make([]byte, 320)))
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = c.Receive()
+		}()
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			_ = c.Destroy()
+		}()
+		wg.Wait()
+
+		_ = c.Destroy()
+		_ = c.Stats()
+	}
+
+	s.waitIdle(t)
+
+	// 所有会话都已释放名额
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err := newTestClient(t, s, uri, WithMaxConcurrentSessions(1)).sessionLimiter.acquire(ctx)
+	if err != nil {
+		t.Fatalf("session slot leaked: %v", err)
+	}
+	release()
+}
+
+func TestSendAfterDestroy(t *testing.T) {
+	s := newTestServer(t, drain)
+	c := newTestClient(t, s, "/closed")
+
+	if err := c.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Send(testFrame(StatusFirstFrame, 1, nil)); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("Send after Destroy: got %v, want ErrStreamClosed", err)
+	}
+	if _, err := c.Receive(); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("Receive after Destroy: got %v, want ErrStreamClosed", err)
+	}
+}
+
+// 多个goroutine并发 Send 时帧不能交错, 服务端按seq收到完整的帧
+func TestConcurrentSend(t *testing.T) {
+	frames := make(chan int, 256)
+	s := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			var req Request
+			if err := conn.ReadJSON(&req); err != nil {
+				close(frames)
+				return
+			}
+			frames <- toInt(req.Header["status"])
+		}
+	})
+
+	c := newTestClient(t, s, "/concurrent", WithStreamValidation(false))
+	defer c.Destroy()
+
+	if err := c.Send(testFrame(StatusFirstFrame, 1, make([]byte, 640))); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if err := c.Send(testFrame(StatusContinue, 0, make([]byte, 640))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	_ = c.Destroy()
+
+	n := 0
+	for range frames {
+		n++
+	}
+	if n != 161 {
+		t.Fatalf("server received %d frames, want 161", n)
+	}
+}
@@ -0,0 +1,358 @@
+package ase
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// convertChunk 每次从源读取的音频帧数
+const convertChunk = 1024
+
+// ConvertAudio 将r中from格式的音频转换为to格式的pcm, 转换在读取时进行.
+// 支持8/16/24/32位pcm、32/64位浮点(EncodingFloat)与G.711 μ-law/A-law(EncodingMuLaw、EncodingALaw)输入;
+// 多声道下混为单声道或单声道复制为多声道, 采样率按线性插值转换, 降采样前先经过抗混叠低通滤波
+func ConvertAudio(r io.Reader, from, to AudioFormat) (io.Reader, error) {
+	if err := checkSampleFormat(from); err != nil {
+		return nil, err
+	}
+	if !to.IsPCM() {
+		return nil, fmt.Errorf("%w: conversion target %+v is not pcm", ErrUnsupportedFormat, to)
+	}
+	if err := checkSampleFormat(to); err != nil {
+		return nil, err
+	}
+	if from.Channels != to.Channels && from.Channels != 1 && to.Channels != 1 {
+		return nil, fmt.Errorf("%w: cannot convert %d channels to %d", ErrUnsupportedFormat, from.Channels, to.Channels)
+	}
+
+	if from == to || (from.IsPCM() && to.IsPCM() && from.SampleRate == to.SampleRate &&
+		from.Channels == to.Channels && from.BitDepth == to.BitDepth) {
+		return r, nil
+	}
+
+	channels := to.Channels
+	c := &converter{
+		r:       r,
+		from:    from,
+		to:      to,
+		inBlock: from.Channels * from.BitDepth / 8,
+		step:    float64(from.SampleRate) / float64(to.SampleRate),
+		mixed:   make([]float64, channels),
+		prev:    make([]float64, channels),
+		cur:     make([]float64, channels),
+		sample:  make([]float64, channels),
+	}
+	if c.step > 1 {
+		c.lowpass = newLowpass(c.step, channels)
+	}
+	return c, nil
+}
+
+// checkSampleFormat 检查是否为可以逐采样解码的格式
+func checkSampleFormat(f AudioFormat) error {
+	if f.SampleRate <= 0 || f.Channels <= 0 {
+		return fmt.Errorf("%w: %+v", ErrUnsupportedFormat, f)
+	}
+
+	switch f.Encoding {
+	case "", EncodingRaw:
+		switch f.BitDepth {
+		case 8, 16, 24, 32:
+			return nil
+		}
+	case EncodingFloat:
+		switch f.BitDepth {
+		case 32, 64:
+			return nil
+		}
+	case EncodingMuLaw, EncodingALaw:
+		if f.BitDepth == 8 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s audio with %d bits", ErrUnsupportedFormat, f.Encoding, f.BitDepth)
+}
+
+// converter 逐块解码、混音、重采样并编码音频
+type converter struct {
+	r        io.Reader
+	from, to AudioFormat
+	inBlock  int // 输入每帧(所有声道的一个采样)的字节数
+
+	buf []byte // 读取缓冲区
+	in  []byte // 不足一帧的输入
+	out []byte // 输出, off 之前的部分已被读取
+	off int
+	err error
+
+	lowpass *lowpass  // 降采样时的抗混叠滤波器, 其余情况为nil
+	mixed   []float64 // 混音后的输入帧
+
+	// 线性插值的状态: prev 为上一个输入帧, pos 为下一个输出帧相对prev的位置
+	step      float64
+	pos       float64
+	prev, cur []float64
+	sample    []float64 // 插值得到的输出帧
+	hasPrev   bool
+}
+
+func (c *converter) Read(p []byte) (int, error) {
+	for c.off == len(c.out) {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.out, c.off = c.out[:0], 0
+		c.fill()
+	}
+
+	n := copy(p, c.out[c.off:])
+	c.off += n
+	return n, nil
+}
+
+// fill 读取一块输入并转换, 读取出错时记录错误
+func (c *converter) fill() {
+	if c.buf == nil {
+		c.buf = make([]byte, (convertChunk+1)*c.inBlock)
+	}
+	buf := c.buf[:copy(c.buf, c.in)]
+	n, err := io.ReadAtLeast(c.r, c.buf[len(buf):], 1)
+	buf = c.buf[:len(buf)+n]
+
+	frames := len(buf) / c.inBlock
+	for i := 0; i < frames; i++ {
+		c.mix(buf[i*c.inBlock : (i+1)*c.inBlock])
+		c.filter()
+	}
+	c.in = append(c.in[:0], buf[frames*c.inBlock:]...)
+
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		if err == io.EOF && c.lowpass != nil {
+			// 输入补0, 取出滤波器中剩余的输出
+			for i := range c.mixed {
+				c.mixed[i] = 0
+			}
+			for i := 0; i < c.lowpass.half; i++ {
+				c.filter()
+			}
+		}
+		c.err = err
+	}
+}
+
+// mix 解码一个输入帧并转换为目标声道数, 结果写入 c.mixed
+func (c *converter) mix(frame []byte) {
+	width := c.from.BitDepth / 8
+
+	switch {
+	case c.from.Channels == c.to.Channels:
+		for ch := range c.mixed {
+			c.mixed[ch] = decodeSample(frame[ch*width:], c.from)
+		}
+	case c.to.Channels == 1:
+		var sum float64
+		for ch := 0; ch < c.from.Channels; ch++ {
+			sum += decodeSample(frame[ch*width:], c.from)
+		}
+		c.mixed[0] = sum / float64(c.from.Channels)
+	default:
+		v := decodeSample(frame, c.from)
+		for ch := range c.mixed {
+			c.mixed[ch] = v
+		}
+	}
+}
+
+// filter 对 c.mixed 低通滤波后重采样
+func (c *converter) filter() {
+	if c.lowpass == nil {
+		c.push(c.mixed)
+		return
+	}
+	if c.lowpass.apply(c.mixed) {
+		c.push(c.mixed)
+	}
+}
+
+// push 按线性插值生成位于prev与cur之间的输出帧
+func (c *converter) push(frame []float64) {
+	if c.step == 1 {
+		c.emit(frame)
+		return
+	}
+
+	copy(c.cur, frame)
+	if !c.hasPrev {
+		c.prev, c.cur = c.cur, c.prev
+		c.hasPrev = true
+		return
+	}
+
+	for ; c.pos < 1; c.pos += c.step {
+		for ch := range c.sample {
+			c.sample[ch] = c.prev[ch] + (c.cur[ch]-c.prev[ch])*c.pos
+		}
+		c.emit(c.sample)
+	}
+	c.pos--
+	c.prev, c.cur = c.cur, c.prev
+}
+
+// lowpass 加Blackman窗的sinc低通滤波器, 截止频率为目标采样率的一半
+type lowpass struct {
+	taps []float64
+	half int         // 群延迟(采样数)
+	hist [][]float64 // 每个声道最近 len(taps) 个输入, 环形缓冲
+	pos  int
+	skip int // 尚需丢弃的输出数, 用于抵消群延迟
+}
+
+// newLowpass 创建降采样倍数为step的抗混叠滤波器
+func newLowpass(step float64, channels int) *lowpass {
+	half := int(math.Ceil(step * 8))
+	n := 2*half + 1
+	fc := 0.5 / step // 截止频率, 以输入采样率为单位
+
+	taps := make([]float64, n)
+	var sum float64
+	for i := range taps {
+		x := float64(i - half)
+		h := 2 * fc
+		if x != 0 {
+			h = math.Sin(2*math.Pi*fc*x) / (math.Pi * x)
+		}
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1)) + 0.08*math.Cos(4*math.Pi*float64(i)/float64(n-1))
+		taps[i] = h * w
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum
+	}
+
+	hist := make([][]float64, channels)
+	for ch := range hist {
+		hist[ch] = make([]float64, n)
+	}
+	return &lowpass{taps: taps, half: half, hist: hist, skip: half}
+}
+
+// apply 输入一帧并在原处写入滤波结果, 群延迟内的输出被丢弃, 此时返回false
+func (l *lowpass) apply(frame []float64) bool {
+	n := len(l.taps)
+	for ch, x := range frame {
+		h := l.hist[ch]
+		h[l.pos] = x
+
+		var y float64
+		j := l.pos
+		for _, t := range l.taps {
+			y += t * h[j]
+			if j--; j < 0 {
+				j = n - 1
+			}
+		}
+		frame[ch] = y
+	}
+	if l.pos++; l.pos == n {
+		l.pos = 0
+	}
+
+	if l.skip > 0 {
+		l.skip--
+		return false
+	}
+	return true
+}
+
+func (c *converter) emit(frame []float64) {
+	for _, v := range frame {
+		c.out = appendSample(c.out, v, c.to.BitDepth)
+	}
+}
+
+// decodeSample 读取一个采样, 归一化到[-1, 1)
+func decodeSample(b []byte, f AudioFormat) float64 {
+	switch f.Encoding {
+	case EncodingFloat:
+		if f.BitDepth == 64 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case EncodingMuLaw:
+		return float64(muLawDecode(b[0])) / 32768
+	case EncodingALaw:
+		return float64(aLawDecode(b[0])) / 32768
+	}
+	return pcmSample(b, f.BitDepth/8)
+}
+
+// appendSample 以小端有符号pcm写入一个采样, 8bit音频为无符号
+func appendSample(b []byte, v float64, bits int) []byte {
+	if v > 1 {
+		v = 1
+	} else if v < -1 {
+		v = -1
+	}
+
+	switch bits {
+	case 8:
+		return append(b, byte(clampInt(math.Round(v*128)+128, 0, 255)))
+	case 16:
+		s := int16(clampInt(math.Round(v*32768), math.MinInt16, math.MaxInt16))
+		return binary.LittleEndian.AppendUint16(b, uint16(s))
+	case 24:
+		s := int32(clampInt(math.Round(v*8388608), -8388608, 8388607))
+		return append(b, byte(s), byte(s>>8), byte(s>>16))
+	case 32:
+		s := int32(clampInt(math.Round(v*2147483648), math.MinInt32, math.MaxInt32))
+		return binary.LittleEndian.AppendUint32(b, uint32(s))
+	}
+	return b
+}
+
+func clampInt(v float64, lo, hi int64) int64 {
+	switch {
+	case v < float64(lo):
+		return lo
+	case v > float64(hi):
+		return hi
+	}
+	return int64(v)
+}
+
+// muLawDecode G.711 μ-law解码为16位线性pcm
+func muLawDecode(u byte) int16 {
+	u = ^u
+	t := (int16(u&0x0F) << 3) + 0x84
+	t <<= (u & 0x70) >> 4
+	if u&0x80 != 0 {
+		return 0x84 - t
+	}
+	return t - 0x84
+}
+
+// aLawDecode G.711 A-law解码为16位线性pcm
+func aLawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int16(a&0x0F) << 4
+	seg := (a & 0x70) >> 4
+	switch seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return t
+	}
+	return -t
+}
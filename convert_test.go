@@ -0,0 +1,172 @@
+package ase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// sinePCM 生成16bit单声道正弦波, 前 delay 个采样为静音
+func sinePCM(rate int, freq float64, n, delay int) []byte {
+	b := make([]byte, 0, n*2)
+	for i := 0; i < n; i++ {
+		var v float64
+		if i >= delay {
+			v = 0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate))
+		}
+		b = binary.LittleEndian.AppendUint16(b, uint16(int16(v*32767)))
+	}
+	return b
+}
+
+func samples16(b []byte) []float64 {
+	res := make([]float64, len(b)/2)
+	for i := range res {
+		res[i] = float64(int16(binary.LittleEndian.Uint16(b[i*2:]))) / 32768
+	}
+	return res
+}
+
+func rms(s []float64) float64 {
+	var sum float64
+	for _, v := range s {
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(s)))
+}
+
+func convert(t *testing.T, in []byte, from, to AudioFormat) []byte {
+	t.Helper()
+
+	r, err := ConvertAudio(bytes.NewReader(in), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestResample(t *testing.T) {
+	mono := func(rate int) AudioFormat {
+		return AudioFormat{Encoding: EncodingRaw, SampleRate: rate, Channels: 1, BitDepth: 16}
+	}
+
+	tests := []struct {
+		name     string
+		from, to int
+		freq     float64
+		min, max float64 // 输出与输入的rms之比
+	}{
+		{"downsample passband", 48000, 16000, 1000, 0.95, 1.05},
+		{"downsample aliasing tone", 48000, 16000, 15000, 0, 0.02},
+		{"downsample 44.1k", 44100, 16000, 12000, 0, 0.02},
+		{"upsample", 8000, 16000, 1000, 0.95, 1.05},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := sinePCM(tt.from, tt.freq, tt.from, 0)
+			out := samples16(convert(t, in, mono(tt.from), mono(tt.to)))
+
+			if want := tt.to; math.Abs(float64(len(out)-want)) > 2 {
+				t.Fatalf("got %d samples, want %d", len(out), want)
+			}
+
+			// 去掉两端滤波器的过渡部分
+			edge := len(out) / 10
+			ratio := rms(out[edge:len(out)-edge]) / rms(samples16(in))
+			if ratio < tt.min || ratio > tt.max {
+				t.Fatalf("rms ratio = %.3f, want [%.2f, %.2f]", ratio, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// 抗混叠滤波器的群延迟已被抵消, 输出与输入在时间上对齐
+func TestResampleAlignment(t *testing.T) {
+	from := AudioFormat{Encoding: EncodingRaw, SampleRate: 48000, Channels: 1, BitDepth: 16}
+	to := AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 1, BitDepth: 16}
+
+	out := samples16(convert(t, sinePCM(48000, 1000, 48000, 24000), from, to))
+
+	onset := -1
+	for i, v := range out {
+		if math.Abs(v) > 0.1 {
+			onset = i
+			break
+		}
+	}
+	if onset < 7995 || onset > 8010 {
+		t.Fatalf("tone starts at sample %d, want about 8000", onset)
+	}
+}
+
+func TestConvertChannels(t *testing.T) {
+	stereo := AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 2, BitDepth: 16}
+	mono := AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 1, BitDepth: 16}
+
+	in := []byte{}
+	for _, v := range []int16{1000, 3000, -2000, 0} {
+		in = binary.LittleEndian.AppendUint16(in, uint16(v))
+	}
+
+	got := convert(t, in, stereo, mono)
+	want := []int16{2000, -1000}
+	for i, w := range want {
+		if s := int16(binary.LittleEndian.Uint16(got[i*2:])); s != w {
+			t.Fatalf("sample %d = %d, want %d", i, s, w)
+		}
+	}
+
+	back := convert(t, got, mono, stereo)
+	if len(back) != len(in) {
+		t.Fatalf("got %d bytes, want %d", len(back), len(in))
+	}
+	if l, r := binary.LittleEndian.Uint16(back), binary.LittleEndian.Uint16(back[2:]); l != r {
+		t.Fatalf("channels differ: %d %d", l, r)
+	}
+}
+
+func TestG711Decode(t *testing.T) {
+	tests := []struct {
+		name   string
+		decode func(byte) int16
+		in     byte
+		want   int16
+	}{
+		{"ulaw zero", muLawDecode, 0xFF, 0},
+		{"ulaw negative zero", muLawDecode, 0x7F, 0},
+		{"ulaw max", muLawDecode, 0x80, 32124},
+		{"ulaw min", muLawDecode, 0x00, -32124},
+		{"ulaw small", muLawDecode, 0xFE, 8},
+		{"alaw smallest", aLawDecode, 0xD5, 8},
+		{"alaw negative smallest", aLawDecode, 0x55, -8},
+		{"alaw max", aLawDecode, 0xAA, 32256},
+		{"alaw min", aLawDecode, 0x2A, -32256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.decode(tt.in); got != tt.want {
+				t.Fatalf("decode(%#x) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkResample(b *testing.B) {
+	from := AudioFormat{Encoding: EncodingRaw, SampleRate: 48000, Channels: 2, BitDepth: 16}
+	to := AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 1, BitDepth: 16}
+	in := make([]byte, 48000*4)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r, _ := ConvertAudio(bytes.NewReader(in), from, to)
+		_, _ = io.Copy(io.Discard, r)
+	}
+}
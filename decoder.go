@@ -0,0 +1,54 @@
+package ase
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Decoder 将压缩音频解码为 ConvertAudio 支持的格式, 通过 RegisterDecoder 注册
+type Decoder interface {
+	// Decode 返回解码后的音频及其格式, 解码在读取时进行
+	Decode(r io.Reader) (io.Reader, AudioFormat, error)
+}
+
+var decoders = struct {
+	sync.RWMutex
+	m map[string]Decoder
+}{
+	m: make(map[string]Decoder),
+}
+
+// RegisterDecoder 为encoding注册解码器, 如 "mp3"、"flac". AudioSourceConfig.Format.Encoding 为该值时,
+// AudioSource 先解码再按 Target 转换后发送. 为 EncodingLame 或 EncodingOpus 注册解码器后这两种格式不再原样发送
+func RegisterDecoder(encoding string, d Decoder) {
+	decoders.Lock()
+	defer decoders.Unlock()
+
+	if d == nil {
+		delete(decoders.m, encoding)
+		return
+	}
+	decoders.m[encoding] = d
+}
+
+func decoderFor(encoding string) Decoder {
+	decoders.RLock()
+	defer decoders.RUnlock()
+
+	return decoders.m[encoding]
+}
+
+// decode 使用注册的解码器解码音频, 没有解码器时原样返回
+func decode(r io.Reader, f AudioFormat) (io.Reader, AudioFormat, error) {
+	d := decoderFor(f.Encoding)
+	if d == nil {
+		return r, f, nil
+	}
+
+	pcm, format, err := d.Decode(r)
+	if err != nil {
+		return nil, f, fmt.Errorf("decode %s audio: %w", f.Encoding, err)
+	}
+	return pcm, format, nil
+}
@@ -0,0 +1,160 @@
+package ase
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrCircuitOpen 熔断器处于打开状态, 请求未被发送
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrStreamClosed 在已关闭的流上写入
+var ErrStreamClosed = errors.New("stream is closed")
+
+// ErrQueueFull 发送队列已满, 见 OverflowFail
+var ErrQueueFull = errors.New("send queue is full")
+
+// ErrEmptySource 来源在返回任何帧之前就已结束, 见 Runner.Run
+var ErrEmptySource = errors.New("source has no frames")
+
+// HTTPError 服务端返回了非预期的http状态码
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http_code: %d, http_msg: %s, body: %s", e.StatusCode, e.Status, string(e.Body))
+}
+
+// WithCheckCode 开启后 Once、OnceAIaaS 与 Receive 在结果的错误码非0时返回 *EngineError, 结果仍随错误一并返回.
+// ASE协议读取 header 中的 code、message 与 sid, AIaaS协议读取顶层的字段. AudioStream、MultiStream 与 Run 总是开启
+func WithCheckCode(enable bool) Option {
+	return func(c *client) {
+		c.checkCode = enable
+	}
+}
+
+// checkResult 开启 WithCheckCode 时将非0错误码转换为 *EngineError
+func (c *client) checkResult(msg []byte, err error) ([]byte, error) {
+	if err != nil || !c.checkCode {
+		return msg, err
+	}
+	return msg, codeErr(msg)
+}
+
+// codeErr 结果的错误码非0时返回 *EngineError
+func codeErr(msg []byte) error {
+	if code, message, sid, ok := peekCode(msg); ok && code != 0 {
+		return &EngineError{Code: code, Message: message, Sid: sid}
+	}
+	return nil
+}
+
+// EngineError 引擎返回了非0的错误码
+type EngineError struct {
+	Code    int
+	Message string
+	Sid     string
+}
+
+func (e *EngineError) Error() string {
+	return fmt.Sprintf("code: %d, message: %s, sid: %s", e.Code, e.Message, e.Sid)
+}
+
+// CloseError 服务端关闭了流式连接. 关闭前收到过非0错误码时 Engine 为最后一个错误.
+// errors.As 可以取得 *EngineError 与原始的 *websocket.CloseError;
+// websocket.IsCloseError 不会解包错误, 需对 Err 调用
+type CloseError struct {
+	Code   int // websocket关闭码, 见 websocket.CloseNormalClosure 等
+	Reason string
+	Engine *EngineError
+	Err    *websocket.CloseError // 原始的关闭错误
+}
+
+func (e *CloseError) Error() string {
+	if e.Engine != nil {
+		return fmt.Sprintf("stream closed (%d %s): %s", e.Code, e.Reason, e.Engine)
+	}
+	return fmt.Sprintf("stream closed (%d %s)", e.Code, e.Reason)
+}
+
+func (e *CloseError) Unwrap() []error {
+	var errs []error
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	if e.Engine != nil {
+		errs = append(errs, e.Engine)
+	}
+	return errs
+}
+
+// streamEnd 记录会话是否已收到最终结果以及最后一个非0错误码, 用于解释连接的关闭
+type streamEnd struct {
+	mu     sync.Mutex
+	final  bool
+	engine *EngineError
+}
+
+func (s *streamEnd) observe(msg []byte) {
+	status, hasStatus := peekStatus(msg)
+	code, message, sid, hasCode := peekCode(msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hasStatus && status == StatusLastFrame {
+		s.final = true
+	}
+	if hasCode && code != 0 {
+		s.engine = &EngineError{Code: code, Message: message, Sid: sid}
+	}
+}
+
+// closeErr 将websocket的关闭转换为 CloseError, 收到最终结果后的正常关闭返回 io.EOF
+func (s *streamEnd) closeErr(err error) error {
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ce.Code == websocket.CloseNormalClosure && s.final && s.engine == nil {
+		return io.EOF
+	}
+	return &CloseError{Code: ce.Code, Reason: ce.Text, Engine: s.engine, Err: ce}
+}
+
+// peekCode 读取结果中的错误码, ASE协议位于 header 中, AIaaS协议位于顶层
+func peekCode(msg []byte) (code int, message, sid string, ok bool) {
+	var resp struct {
+		Header *struct {
+			Code    *int   `json:"code"`
+			Message string `json:"message"`
+			Sid     string `json:"sid"`
+		} `json:"header"`
+		Code    *int   `json:"code"`
+		Message string `json:"message"`
+		Sid     string `json:"sid"`
+	}
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return 0, "", "", false
+	}
+
+	switch {
+	case resp.Header != nil && resp.Header.Code != nil:
+		return *resp.Header.Code, resp.Header.Message, resp.Header.Sid, true
+	case resp.Code != nil:
+		return *resp.Code, resp.Message, resp.Sid, true
+	}
+	return 0, "", "", false
+}
@@ -0,0 +1,58 @@
+package ase
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStreamEndCloseErr(t *testing.T) {
+	final := []byte(`{"header":{"code":0,"status":2}}`)
+	failed := []byte(`{"header":{"code":10110,"message":"licc limit","sid":"ase0001","status":1}}`)
+	normal := &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	abnormal := &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: "unexpected EOF"}
+
+	tests := []struct {
+		name     string
+		msgs     [][]byte
+		err      error
+		eof      bool
+		engine   int // 期望的 EngineError.Code, 0表示没有
+		closeErr *websocket.CloseError
+	}{
+		{name: "normal close after final result", msgs: [][]byte{final}, err: normal, eof: true},
+		{name: "normal close before final result", err: normal, closeErr: normal},
+		{name: "abnormal close", msgs: [][]byte{final}, err: abnormal, closeErr: abnormal},
+		{name: "close after engine error", msgs: [][]byte{failed, final}, err: normal, engine: 10110, closeErr: normal},
+		{name: "other error", err: io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s streamEnd
+			for _, msg := range tt.msgs {
+				s.observe(msg)
+			}
+
+			err := s.closeErr(tt.err)
+			if got := errors.Is(err, io.EOF); got != tt.eof {
+				t.Fatalf("got %v, want io.EOF=%v", err, tt.eof)
+			}
+
+			var ee *EngineError
+			if errors.As(err, &ee) != (tt.engine != 0) || (ee != nil && ee.Code != tt.engine) {
+				t.Fatalf("got %v, want engine code %d", err, tt.engine)
+			}
+
+			var wce *websocket.CloseError
+			if errors.As(err, &wce) != (tt.closeErr != nil) || (wce != nil && wce != tt.closeErr) {
+				t.Fatalf("got %v, want websocket close error %v", err, tt.closeErr)
+			}
+			if tt.closeErr == nil && !tt.eof && err != tt.err {
+				t.Fatalf("got %v, want %v unchanged", err, tt.err)
+			}
+		})
+	}
+}
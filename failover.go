@@ -0,0 +1,174 @@
+package ase
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultHostCooldown = 30 * time.Second
+
+// Endpoint 服务地址
+type Endpoint struct {
+	Host     string // eg: cn-huadong-1.xf-yun.com
+	Priority int    // 数值越小越优先
+}
+
+// WithHosts 设置多个服务地址, 替代 NewClient 的host参数.
+// Once 调用与websocket建连优先使用健康且优先级高的地址, 失败时依次切换到下一个地址, 签名按实际请求的地址计算
+func WithHosts(endpoints ...Endpoint) Option {
+	return func(c *client) {
+		if c.endpoints == nil {
+			c.endpoints = newEndpointSet()
+		}
+		c.endpoints.setEndpoints(endpoints)
+	}
+}
+
+// WithFailover 设置地址切换策略.
+// cooldown: 失败的地址在该时间内被视为不健康, 排在健康地址之后, 默认30秒
+// codes: 除网络错误与熔断外, 触发切换的http状态码或引擎错误码(header.code/code)
+func WithFailover(cooldown time.Duration, codes ...int) Option {
+	return func(c *client) {
+		if c.endpoints == nil {
+			c.endpoints = newEndpointSet()
+		}
+		if cooldown > 0 {
+			c.endpoints.cooldown = cooldown
+		}
+		for _, code := range codes {
+			c.endpoints.codes[code] = true
+		}
+	}
+}
+
+type endpoint struct {
+	Endpoint
+	unhealthyUntil time.Time
+}
+
+type endpointSet struct {
+	mu       sync.Mutex
+	list     []*endpoint
+	cooldown time.Duration
+	codes    map[int]bool
+}
+
+func newEndpointSet() *endpointSet {
+	return &endpointSet{
+		cooldown: defaultHostCooldown,
+		codes:    make(map[int]bool),
+	}
+}
+
+func (s *endpointSet) setEndpoints(endpoints []Endpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.list = s.list[:0]
+	for _, ep := range endpoints {
+		s.list = append(s.list, &endpoint{Endpoint: ep})
+	}
+	sort.SliceStable(s.list, func(i, j int) bool {
+		return s.list[i].Priority < s.list[j].Priority
+	})
+}
+
+// primary 优先级最高的地址
+func (s *endpointSet) primary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.list) == 0 {
+		return ""
+	}
+	return s.list[0].Host
+}
+
+// order 返回本次请求尝试的地址顺序: 健康的地址在前, 各自按优先级排列
+func (s *endpointSet) order() []*endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]*endpoint, 0, len(s.list))
+	var unhealthy []*endpoint
+	for _, ep := range s.list {
+		if now.Before(ep.unhealthyUntil) {
+			unhealthy = append(unhealthy, ep)
+			continue
+		}
+		healthy = append(healthy, ep)
+	}
+
+	return append(healthy, unhealthy...)
+}
+
+func (s *endpointSet) mark(ep *endpoint, healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if healthy {
+		ep.unhealthyUntil = time.Time{}
+		return
+	}
+	ep.unhealthyUntil = time.Now().Add(s.cooldown)
+}
+
+// shouldFailover 判断请求结果是否需要切换到下一个地址
+func (s *endpointSet) shouldFailover(body []byte, err error) bool {
+	if err == nil {
+		if len(s.codes) == 0 || len(body) == 0 {
+			return false
+		}
+		code, _, _, ok := peekCode(body)
+		return ok && s.codes[code]
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var he *HTTPError
+	if errors.As(err, &he) {
+		if s.codes[he.StatusCode] {
+			return true
+		}
+		code, _, _, ok := peekCode(he.Body)
+		return ok && s.codes[code]
+	}
+
+	return true
+}
+
+// failover 依次在各地址上执行fn, 直到成功或所有地址均已尝试
+func (c *client) failover(fn func(host string) ([]byte, error)) (body []byte, err error) {
+	return c.failoverFrom(0, fn)
+}
+
+// failoverFrom 同 failover, 从第offset个地址开始尝试
+func (c *client) failoverFrom(offset int, fn func(host string) ([]byte, error)) (body []byte, err error) {
+	order := c.endpoints.order()
+	offset %= len(order)
+	for _, ep := range append(order[offset:], order[:offset]...) {
+		body, err = fn(ep.Host)
+		if !c.endpoints.shouldFailover(body, err) {
+			if err == nil {
+				c.endpoints.mark(ep, true)
+			}
+			return
+		}
+		c.endpoints.mark(ep, false)
+
+		if err != nil {
+			c.log.Warn("ase failover", "host", ep.Host, "uri", c.uri, c.errAttr(err))
+		} else {
+			code, _, _, _ := peekCode(body)
+			c.log.Warn("ase failover", "host", ep.Host, "uri", c.uri, "code", code)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,216 @@
+package ase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// StreamHandler 处理流式会话的事件, 见 Runner.Run. 除 OnError 外的方法在同一个goroutine中依次调用
+type StreamHandler interface {
+	// OnOpen 收到首个结果时调用, sid 为服务端会话id
+	OnOpen(sid string)
+	// OnPartial 收到中间结果
+	OnPartial(resp *Resp)
+	// OnFinal 收到最终结果(header.status 为 StatusLastFrame)
+	OnFinal(resp *Resp)
+	// OnError 发送或接收出错, 包括非0的错误码(*EngineError)
+	OnError(err error)
+	// OnClose 会话结束时调用
+	OnClose(stats StreamStats)
+}
+
+// Run 在会话上发送source中的所有帧并将结果分发给handler, 收到最终结果、出错或ctx结束时返回, 返回前 Destroy 会话.
+// 结果的 Resp.Payload 为 json.RawMessage, 结果不含payload时为nil. source 在发送尾帧前返回 io.EOF 时补发不含payload的尾帧,
+// 没有返回任何帧时返回 ErrEmptySource. 连接在source返回首帧后才建立, 等待语音期间不会因空闲被服务端断开.
+// source 实现了 io.Closer 时在返回前关闭
+func (c *client) Run(ctx context.Context, source Source, handler StreamHandler) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		_ = c.Destroy()
+		if cl, ok := source.(io.Closer); ok {
+			_ = cl.Close()
+		}
+		handler.OnClose(c.Stats())
+	}()
+
+	var (
+		mu     sync.Mutex
+		runErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		first := runErr == nil
+		if first {
+			runErr = err
+		}
+		mu.Unlock()
+
+		if first {
+			handler.OnError(err)
+			cancel()
+		}
+	}
+
+	connected := make(chan struct{})
+	go func() {
+		if err := c.sendSource(ctx, source, connected); err != nil && ctx.Err() == nil {
+			fail(err)
+		}
+	}()
+
+	select {
+	case <-connected:
+		// ctx结束时关闭连接, 中断阻塞中的 Receive
+		stop := context.AfterFunc(ctx, func() {
+			_ = c.Destroy()
+		})
+		defer stop()
+
+		if err := c.dispatch(handler, source); err != nil && ctx.Err() == nil {
+			fail(err)
+		}
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if runErr != nil {
+		return runErr
+	}
+	return parent.Err()
+}
+
+// sendSource 依次发送source中的帧直到尾帧, 取得首帧后建立连接并关闭connected
+func (c *client) sendSource(ctx context.Context, source Source, connected chan<- struct{}) error {
+	inj, _ := source.(injector)
+	sent := false
+	for {
+		req, err := source.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			if !sent {
+				return ErrEmptySource
+			}
+			return c.Send(&Request{Header: RequestHeader{"app_id": c.appid, "status": StatusLastFrame}})
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, ok := req.Header["app_id"]; !ok {
+			if req.Header == nil {
+				req.Header = RequestHeader{}
+			}
+			req.Header.SetAppID(c.appid)
+		}
+
+		if !sent {
+			if err = c.Connect(ctx); err != nil {
+				return err
+			}
+			close(connected)
+		}
+
+		if err = c.Send(req); err != nil {
+			return err
+		}
+		sent = true
+		if inj != nil && inj.wasInjected() {
+			c.stats.inject()
+		}
+		if frameStatus(req) == StatusLastFrame {
+			return nil
+		}
+	}
+}
+
+// injector 由会插入静音帧的来源实现, 返回最近一次 Next 返回的帧是否为插入的静音
+type injector interface {
+	wasInjected() bool
+}
+
+// timeline 由跳过了部分音频的来源实现, 返回已发送音频中t时刻对应的源音频偏移
+type timeline interface {
+	offsetAt(t time.Duration) time.Duration
+}
+
+// dispatch 读取结果并分发给handler直到最终结果, 来源跳过了部分音频时将结果的时间戳还原为源音频中的时间
+func (c *client) dispatch(handler StreamHandler, source Source) error {
+	tl, _ := source.(timeline)
+	opened := false
+	for {
+		msg, err := c.Receive()
+		if err == nil {
+			err = codeErr(msg)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(msg) == 0 {
+			continue
+		}
+
+		if tl != nil {
+			if msg, err = c.restoreTime(msg, tl); err != nil {
+				return err
+			}
+		}
+
+		var raw struct {
+			Header  *Header         `json:"header"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err = json.Unmarshal(msg, &raw); err != nil {
+			return err
+		}
+
+		resp := &Resp{Header: raw.Header}
+		if len(raw.Payload) > 0 {
+			resp.Payload = raw.Payload
+		}
+		if resp.Header == nil {
+			resp.Header = &Header{}
+		}
+
+		if !opened {
+			opened = true
+			handler.OnOpen(resp.Header.Sid)
+		}
+
+		if resp.Header.Status == StatusLastFrame {
+			handler.OnFinal(resp)
+			return nil
+		}
+		handler.OnPartial(resp)
+	}
+}
+
+// restoreTime 将结果的起止时间分别映射为源音频中的时间, 片段跨过被跳过的音频时两者的偏移不同
+func (c *client) restoreTime(msg []byte, tl timeline) ([]byte, error) {
+	seg, ok, err := c.codec.Segment(msg)
+	if err != nil || !ok {
+		return msg, nil
+	}
+
+	begin := tl.offsetAt(seg.Begin)
+	end := begin
+	if seg.End > seg.Begin {
+		// ed 是片段的结束边界, 按其前一刻的音频所在位置映射
+		end = tl.offsetAt(seg.End - 1)
+	}
+
+	switch s, ok := c.codec.(SegmentShifter); {
+	case begin == 0 && end == 0:
+		return msg, nil
+	case ok:
+		return s.ShiftSegment(msg, begin, end)
+	}
+	return c.codec.Shift(msg, begin)
+}
@@ -0,0 +1,197 @@
+package ase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// recordingHandler 记录收到的事件
+type recordingHandler struct {
+	mu     sync.Mutex
+	events []string
+	errs   []error
+	final  *Resp
+}
+
+func (h *recordingHandler) add(e string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, e)
+}
+
+func (h *recordingHandler) OnOpen(string)       { h.add("open") }
+func (h *recordingHandler) OnPartial(*Resp)     { h.add("partial") }
+func (h *recordingHandler) OnClose(StreamStats) { h.add("close") }
+func (h *recordingHandler) OnFinal(resp *Resp)  { h.add("final"); h.final = resp }
+func (h *recordingHandler) OnError(err error)   { h.add("error"); h.errs = append(h.errs, err) }
+
+func TestRun(t *testing.T) {
+	s := newTestServer(t, func(conn *websocket.Conn) {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if status, _ := peekStatus(msg); status == StatusLastFrame {
+				_ = conn.WriteMessage(websocket.TextMessage, testResult(0, 40, StatusContinue))
+				_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"header":{"code":0,"status":2}}`))
+				drain(conn)
+				return
+			}
+		}
+	})
+	c := newTestClient(t, s, "/run")
+
+	source := NewAudioSource(bytes.NewReader(make([]byte, 3200)), AudioSourceConfig{
+		Parameter: map[string]interface{}{"engine": map[string]interface{}{"lang": "cn"}},
+		Format:    AudioFormat{SampleRate: 16000, Channels: 1, BitDepth: 16},
+	})
+
+	h := &recordingHandler{}
+	if err := c.Run(context.Background(), source, h); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"open", "partial", "final", "close"}
+	if len(h.events) != len(want) {
+		t.Fatalf("events = %v, want %v", h.events, want)
+	}
+	for i := range want {
+		if h.events[i] != want[i] {
+			t.Fatalf("events = %v, want %v", h.events, want)
+		}
+	}
+	if h.final.Payload != nil {
+		t.Fatalf("final payload = %v, want nil", h.final.Payload)
+	}
+}
+
+// 没有任何帧的来源返回 ErrEmptySource, 而不是被帧校验拒绝的尾帧
+func TestRunEmptySource(t *testing.T) {
+	s := newTestServer(t, drain)
+	c := newTestClient(t, s, "/run-empty")
+
+	h := &recordingHandler{}
+	source := NewAudioSource(bytes.NewReader(nil), AudioSourceConfig{
+		Parameter: map[string]interface{}{"engine": map[string]interface{}{"lang": "cn"}},
+		Format:    AudioFormat{SampleRate: 16000, Channels: 1, BitDepth: 16},
+	})
+	err := c.Run(context.Background(), source, h)
+	if !errors.Is(err, ErrEmptySource) {
+		t.Fatalf("err = %v, want ErrEmptySource", err)
+	}
+	if len(h.errs) != 1 || !errors.Is(h.errs[0], ErrEmptySource) {
+		t.Fatalf("OnError got %v", h.errs)
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	s := newTestServer(t, drain)
+	c := newTestClient(t, s, "/run-canceled")
+
+	source := NewAudioSource(bytes.NewReader(make([]byte, 1280)), AudioSourceConfig{
+		Parameter: map[string]interface{}{"engine": map[string]interface{}{"lang": "cn"}},
+		Format:    AudioFormat{SampleRate: 16000, Channels: 1, BitDepth: 16},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	h := &recordingHandler{}
+	if err := c.Run(ctx, source, h); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if !c.isClosed() {
+		t.Fatal("session is not destroyed")
+	}
+}
+
+// gatedSource 在gate关闭前不返回帧, 模拟等待语音的来源
+type gatedSource struct {
+	gate  chan struct{}
+	frame *Request
+}
+
+func (g *gatedSource) Next(ctx context.Context) (*Request, error) {
+	select {
+	case <-g.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	req := g.frame
+	g.frame = nil
+	if req == nil {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+// 来源返回首帧之前不建立连接
+func TestRunConnectsOnFirstFrame(t *testing.T) {
+	var dials atomic.Int32
+	s := newTestServer(t, func(conn *websocket.Conn) {
+		dials.Add(1)
+		lastFrameServer(conn)
+	})
+	c := newTestClient(t, s, "/run-lazy")
+
+	source := &gatedSource{gate: make(chan struct{}), frame: testFrame(StatusFirstFrame, 1, make([]byte, 1280))}
+	source.frame.SetParameters(map[string]interface{}{"engine": map[string]interface{}{"lang": "cn"}})
+
+	errc := make(chan error, 1)
+	go func() { errc <- c.Run(context.Background(), source, &recordingHandler{}) }()
+
+	time.Sleep(100 * time.Millisecond)
+	if n := dials.Load(); n != 0 {
+		t.Fatalf("dialed %d times before the first frame", n)
+	}
+
+	close(source.gate)
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if n := dials.Load(); n != 1 {
+		t.Fatalf("dialed %d times, want 1", n)
+	}
+}
+
+func TestRestoreTime(t *testing.T) {
+	// 已发送音频的第1秒之后跳过了源音频中的2秒
+	var tl timeMap
+	tl.record(0, time.Second)
+	tl.record(3*time.Second, time.Second)
+
+	tests := []struct {
+		name           string
+		bg, ed         int64
+		wantBg, wantEd int64
+	}{
+		{"before skip", 200, 800, 200, 800},
+		{"ends at skip", 0, 1000, 0, 1000},
+		{"across skip", 500, 1500, 500, 3500},
+		{"after skip", 1200, 1800, 3200, 3800},
+	}
+
+	c := &client{codec: ASETimestampCodec{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := c.restoreTime(testResult(tt.bg, tt.ed, StatusContinue), &tl)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seg, _, _ := c.codec.Segment(msg)
+			if bg, ed := seg.Begin.Milliseconds(), seg.End.Milliseconds(); bg != tt.wantBg || ed != tt.wantEd {
+				t.Fatalf("restored to %d-%d, want %d-%d", bg, ed, tt.wantBg, tt.wantEd)
+			}
+		})
+	}
+}
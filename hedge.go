@@ -0,0 +1,148 @@
+package ase
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgePercentile = 0.95
+	hedgeLatencySamples    = 128
+	hedgeMinSamples        = 20 // 样本不足时不发送对冲请求
+)
+
+// HedgeConfig 对冲请求配置
+type HedgeConfig struct {
+	// Delay 首个请求在该时间内未返回时发送对冲请求; 为0时使用近期成功请求延迟的 Percentile 分位数
+	Delay time.Duration
+	// Percentile 延迟分位数, 默认0.95
+	Percentile float64
+	// AlternateHost 对冲请求发往下一个服务地址(见 WithHosts), 否则发往同一地址
+	AlternateHost bool
+}
+
+// WithHedging 为 Once 与 OnceAIaaS 开启对冲请求: 首个请求迟迟未返回时发送一个相同的请求,
+// 采用先成功返回的结果并取消另一个请求. 仅适用于可重复执行的短请求
+func WithHedging(cfg HedgeConfig) Option {
+	return func(c *client) {
+		if cfg.Percentile <= 0 || cfg.Percentile >= 1 {
+			cfg.Percentile = defaultHedgePercentile
+		}
+		c.hedger = &hedger{cfg: cfg}
+	}
+}
+
+type hedger struct {
+	cfg HedgeConfig
+
+	mu        sync.Mutex
+	latencies [hedgeLatencySamples]time.Duration
+	n         int
+}
+
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.latencies[h.n%hedgeLatencySamples] = d
+	h.n++
+}
+
+// delay 发送对冲请求前的等待时间, 返回0表示不发送对冲请求
+func (h *hedger) delay() time.Duration {
+	if h.cfg.Delay > 0 {
+		return h.cfg.Delay
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.n
+	if n < hedgeMinSamples {
+		return 0
+	}
+	if n > hedgeLatencySamples {
+		n = hedgeLatencySamples
+	}
+
+	samples := make([]time.Duration, n)
+	copy(samples, h.latencies[:n])
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+
+	return samples[int(float64(n-1)*h.cfg.Percentile)]
+}
+
+type hedgeResult struct {
+	body []byte
+	err  error
+}
+
+// hedge 执行call, 超过对冲等待时间仍未返回时再发送一个对冲请求, 返回先成功的结果.
+// offset 为请求起始的服务地址序号
+func (c *client) hedge(ctx context.Context, call func(ctx context.Context, offset int) ([]byte, error)) ([]byte, error) {
+	if c.hedger == nil {
+		return call(ctx, 0)
+	}
+
+	start := time.Now()
+	delay := c.hedger.delay()
+	if delay <= 0 {
+		body, err := call(ctx, 0)
+		if err == nil {
+			c.hedger.observe(time.Since(start))
+		}
+		return body, err
+	}
+
+	// 返回时取消仍未结束的请求
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	run := func(offset int) {
+		body, err := call(ctx, offset)
+		results <- hedgeResult{body: body, err: err}
+	}
+
+	go run(0)
+	inflight, hedged := 1, false
+
+	tm := time.NewTimer(delay)
+	defer tm.Stop()
+
+	var last hedgeResult
+	for {
+		select {
+		case <-tm.C:
+			if hedged {
+				continue
+			}
+			hedged = true
+			inflight++
+
+			offset := 0
+			if c.hedger.cfg.AlternateHost {
+				offset = 1
+			}
+			c.log.DebugContext(ctx, "ase hedge", "uri", c.uri, "delay", delay, "alternate_host", c.hedger.cfg.AlternateHost)
+			go run(offset)
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				c.hedger.observe(time.Since(start))
+				return r.body, nil
+			}
+
+			last = r
+			if inflight == 0 {
+				return last.body, last.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ase
+
+import (
+	"context"
+	"fmt"
+)
+
+// OnceInvoker 发送一次非流式请求, req 为 *Request 或 *AIaaSRequest
+type OnceInvoker func(ctx context.Context, req interface{}) ([]byte, error)
+
+// OnceInterceptor 拦截 Once 与 OnceAIaaS, 可以修改请求、记录日志或不调用next直接返回
+type OnceInterceptor func(ctx context.Context, req interface{}, next OnceInvoker) ([]byte, error)
+
+// SendInvoker 发送一帧流式请求, req 为 *Request 或 *AIaaSRequest
+type SendInvoker func(ctx context.Context, req interface{}) error
+
+// SendInterceptor 拦截 Send 与 SendAIaaS
+type SendInterceptor func(ctx context.Context, req interface{}, next SendInvoker) error
+
+// ReceiveInvoker 接收一条流式结果
+type ReceiveInvoker func(ctx context.Context) ([]byte, error)
+
+// ReceiveInterceptor 拦截 Receive
+type ReceiveInterceptor func(ctx context.Context, next ReceiveInvoker) ([]byte, error)
+
+// WithOnceInterceptor 添加非流式请求拦截器, 先添加的拦截器位于外层
+func WithOnceInterceptor(interceptor OnceInterceptor) Option {
+	return func(c *client) {
+		c.onceInterceptors = append(c.onceInterceptors, interceptor)
+	}
+}
+
+// WithSendInterceptor 添加流式发送拦截器, 先添加的拦截器位于外层
+func WithSendInterceptor(interceptor SendInterceptor) Option {
+	return func(c *client) {
+		c.sendInterceptors = append(c.sendInterceptors, interceptor)
+	}
+}
+
+// WithReceiveInterceptor 添加流式接收拦截器, 先添加的拦截器位于外层
+func WithReceiveInterceptor(interceptor ReceiveInterceptor) Option {
+	return func(c *client) {
+		c.receiveInterceptors = append(c.receiveInterceptors, interceptor)
+	}
+}
+
+func (c *client) invokeOnce(ctx context.Context, req interface{}) ([]byte, error) {
+	invoker := c.doOnce
+	for i := len(c.onceInterceptors) - 1; i >= 0; i-- {
+		interceptor, next := c.onceInterceptors[i], invoker
+		invoker = func(ctx context.Context, req interface{}) ([]byte, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+
+	return invoker(ctx, req)
+}
+
+func (c *client) invokeSend(ctx context.Context, req interface{}) error {
+	invoker := c.doSend
+	for i := len(c.sendInterceptors) - 1; i >= 0; i-- {
+		interceptor, next := c.sendInterceptors[i], invoker
+		invoker = func(ctx context.Context, req interface{}) error {
+			return interceptor(ctx, req, next)
+		}
+	}
+
+	return invoker(ctx, req)
+}
+
+func (c *client) invokeReceive(ctx context.Context) ([]byte, error) {
+	invoker := c.doReceive
+	for i := len(c.receiveInterceptors) - 1; i >= 0; i-- {
+		interceptor, next := c.receiveInterceptors[i], invoker
+		invoker = func(ctx context.Context) ([]byte, error) {
+			return interceptor(ctx, next)
+		}
+	}
+
+	return invoker(ctx)
+}
+
+func unsupportedRequest(req interface{}) error {
+	return fmt.Errorf("unsupported request type %T", req)
+}
@@ -0,0 +1,167 @@
+package ase
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrPongTimeout 在 pongTimeout 内未收到服务端的pong, 连接已被关闭
+var ErrPongTimeout = errors.New("websocket pong timeout")
+
+// WithStreamPing 每隔interval向服务端发送ping, pongTimeout 内未收到pong时判定连接失效并关闭,
+// 阻塞中的 Receive 随即返回 ErrPongTimeout. pong 只在 Receive 读取期间被处理, 开启后需持续调用 Receive.
+// 最近一次ping的往返时间见 StreamStats.RTT
+func WithStreamPing(interval, pongTimeout time.Duration) Option {
+	return func(c *client) {
+		c.pingInterval = interval
+		c.pongTimeout = pongTimeout
+	}
+}
+
+// keepalive 单条连接的保活与生命周期管理
+type keepalive struct {
+	conn *websocket.Conn
+	done chan struct{}
+	once sync.Once
+
+	mu       sync.Mutex
+	pongWait *time.Timer
+	dead     bool
+}
+
+// watch 为新建立的连接启动保活与生命周期计时
+func (c *client) watch(conn *websocket.Conn) {
+	k := &keepalive{conn: conn, done: make(chan struct{})}
+
+	c.watchMu.Lock()
+	if c.watches == nil {
+		c.watches = make(map[*websocket.Conn]*keepalive)
+	}
+	c.watches[conn] = k
+	c.watchMu.Unlock()
+
+	if c.connTimeout > 0 {
+		go func() {
+			tm := time.NewTimer(c.connTimeout)
+			defer tm.Stop()
+
+			select {
+			case <-tm.C:
+				c.log.Info("ase stream lifetime expired", "uri", c.uri, "lifetime", c.connTimeout)
+				_ = c.closeConn(conn)
+			case <-k.done:
+			}
+		}()
+	}
+
+	if c.pingInterval > 0 {
+		conn.SetPongHandler(func(data string) error {
+			k.pong(c, data)
+			return nil
+		})
+		go k.ping(c)
+	}
+}
+
+func (k *keepalive) ping(c *client) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-k.done:
+			return
+		}
+
+		now := time.Now()
+		data := []byte(strconv.FormatInt(now.UnixNano(), 10))
+		if err := k.conn.WriteControl(websocket.PingMessage, data, now.Add(c.pingInterval)); err != nil {
+			return
+		}
+
+		if c.pongTimeout <= 0 {
+			continue
+		}
+
+		k.mu.Lock()
+		if k.pongWait == nil {
+			k.pongWait = time.AfterFunc(c.pongTimeout, func() {
+				k.mu.Lock()
+				k.dead = true
+				k.mu.Unlock()
+
+				c.log.Warn("ase stream pong timeout", "uri", c.uri, "timeout", c.pongTimeout)
+				// 保留记录, 由 connErr 报告 ErrPongTimeout 后删除
+				k.stop()
+				_ = k.conn.Close()
+			})
+		}
+		k.mu.Unlock()
+	}
+}
+
+// pong 收到pong时计算往返时间并取消失效判定
+func (k *keepalive) pong(c *client, data string) {
+	if sent, err := strconv.ParseInt(data, 10, 64); err == nil {
+		c.stats.rtt(time.Since(time.Unix(0, sent)))
+	}
+
+	k.mu.Lock()
+	if k.pongWait != nil {
+		k.pongWait.Stop()
+		k.pongWait = nil
+	}
+	k.mu.Unlock()
+}
+
+func (k *keepalive) isDead() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.dead
+}
+
+func (k *keepalive) stop() {
+	k.once.Do(func() {
+		close(k.done)
+
+		k.mu.Lock()
+		if k.pongWait != nil {
+			k.pongWait.Stop()
+		}
+		k.mu.Unlock()
+	})
+}
+
+// closeConn 关闭连接并停止其保活计时
+func (c *client) closeConn(conn *websocket.Conn) error {
+	c.watchMu.Lock()
+	k := c.watches[conn]
+	delete(c.watches, conn)
+	c.watchMu.Unlock()
+
+	if k != nil {
+		k.stop()
+	}
+
+	return conn.Close()
+}
+
+// connErr 连接因pong超时被关闭时返回 ErrPongTimeout
+func (c *client) connErr(conn *websocket.Conn, err error) error {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	k := c.watches[conn]
+	if k == nil || !k.isDead() {
+		return err
+	}
+
+	delete(c.watches, conn)
+	return ErrPongTimeout
+}
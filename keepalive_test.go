@@ -0,0 +1,56 @@
+package ase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func watchCount(c *client) int {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	return len(c.watches)
+}
+
+func TestPongTimeout(t *testing.T) {
+	// 服务端不读取连接, 不会回复pong
+	s := newTestServer(t, func(conn *websocket.Conn) {
+		time.Sleep(200 * time.Millisecond)
+	})
+
+	c := newTestClient(t, s, "/pong-timeout", WithStreamPing(20*time.Millisecond, 20*time.Millisecond))
+	defer c.Destroy()
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Receive(); !errors.Is(err, ErrPongTimeout) {
+		t.Fatalf("got %v, want ErrPongTimeout", err)
+	}
+	if n := watchCount(c); n != 0 {
+		t.Fatalf("%d keepalive entries left after pong timeout", n)
+	}
+}
+
+func TestCloseConnRemovesWatch(t *testing.T) {
+	s := newTestServer(t, drain)
+
+	c := newTestClient(t, s, "/watch", WithStreamPing(time.Second, time.Second), WithStreamConnTimeout(time.Minute))
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := watchCount(c); n != 1 {
+		t.Fatalf("got %d keepalive entries, want 1", n)
+	}
+
+	if err := c.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if n := watchCount(c); n != 0 {
+		t.Fatalf("%d keepalive entries left after Destroy", n)
+	}
+}
@@ -0,0 +1,211 @@
+package ase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const redacted = "[REDACTED]"
+
+// 日志中需要整体隐藏的字段, 通常为base64编码的音频、图片等数据
+var redactedFields = map[string]bool{
+	"audio":         true,
+	"image":         true,
+	"video":         true,
+	"authorization": true,
+}
+
+var authorizationPattern = regexp.MustCompile(`(?i)(authorization=)[^&"\s]+`)
+
+// WithLogger 设置日志, 记录建连、握手、收发帧的元数据(状态、序号、大小)、重试与关闭原因.
+// apiSecret、url中的 authorization 参数以及音频、图片等数据不会出现在日志中
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *client) {
+		if logger == nil {
+			return
+		}
+		c.log = logger
+		c.onceCaller.cli.AddRetryHook(func(res *resty.Response, err error) {
+			attrs := []any{"host", c.host, "uri", c.uri}
+			if res != nil {
+				attrs = append(attrs, "attempt", res.Request.Attempt, "http_code", res.StatusCode())
+			}
+			if err != nil {
+				attrs = append(attrs, c.errAttr(err))
+			}
+			c.log.Info("ase once retry", attrs...)
+		})
+	}
+}
+
+// discardHandler 未设置日志时丢弃所有日志
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// errAttr 以脱敏后的形式记录错误
+func (c *client) errAttr(err error) slog.Attr {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return slog.Group("error",
+			"http_code", he.StatusCode,
+			"http_msg", he.Status,
+			"body", c.redactText(redactBody(he.Body)),
+		)
+	}
+
+	return slog.String("error", c.redactText(err.Error()))
+}
+
+// redactText 隐藏文本中的签名参数与密钥
+func (c *client) redactText(s string) string {
+	s = authorizationPattern.ReplaceAllString(s, "${1}"+redacted)
+	if c.apiSecret != "" {
+		s = strings.ReplaceAll(s, c.apiSecret, redacted)
+	}
+	return s
+}
+
+// redactBody 隐藏json中的音频、图片等数据, 非json内容只记录长度
+func redactBody(body []byte) string {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Sprintf("[%d bytes]", len(body))
+	}
+
+	b, _ := json.Marshal(redactValue("", doc))
+	return string(b)
+}
+
+func redactValue(key string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, f := range val {
+			val[k] = redactValue(k, f)
+		}
+		return val
+	case []interface{}:
+		for i, f := range val {
+			val[i] = redactValue(key, f)
+		}
+		return val
+	case string:
+		if redactedFields[strings.ToLower(key)] {
+			return fmt.Sprintf("[REDACTED %d bytes]", len(val))
+		}
+	}
+	return v
+}
+
+// frameAttrs 记录请求帧的元数据
+func frameAttrs(v interface{}) []any {
+	status, seqs, size := frameMeta(v)
+	attrs := []any{"status", status, "audio_bytes", size}
+	if len(seqs) > 0 {
+		attrs = append(attrs, "seq", seqs)
+	}
+	return attrs
+}
+
+// frameMeta 读取请求帧的状态、各payload的序号以及音频字节数
+func frameMeta(v interface{}) (status int, seqs map[string]int, audioBytes int) {
+	status = frameStatus(v)
+
+	switch req := v.(type) {
+	case *Request:
+		seqs = make(map[string]int, len(req.Payload))
+		for k, p := range req.Payload {
+			seqs[k] = payloadSeq(p)
+			if _, audio, ok := audioOf(p); ok {
+				audioBytes += base64DecodedLen(audio)
+			}
+		}
+	case *AIaaSRequest:
+		audio, _ := req.Data["audio"].(string)
+		audioBytes = base64DecodedLen(audio)
+	}
+
+	return
+}
+
+// msgAttrs 记录结果的元数据
+func msgAttrs(msg []byte) []any {
+	attrs := []any{"bytes", len(msg)}
+	if status, ok := peekStatus(msg); ok {
+		attrs = append(attrs, "status", status)
+	}
+	if code, _, sid, ok := peekCode(msg); ok {
+		attrs = append(attrs, "code", code, "sid", sid)
+	}
+	return attrs
+}
+
+func payloadSeq(p interface{}) int {
+	switch v := p.(type) {
+	case *AudioPayload:
+		return v.Seq
+	case map[string]interface{}:
+		return toInt(v["seq"])
+	}
+	return 0
+}
+
+func (c *client) logOnce(ctx context.Context, host string, start time.Time, body []byte, err error) {
+	if err != nil {
+		c.log.WarnContext(ctx, "ase once failed", "host", host, "uri", c.uri, "cost", time.Since(start), c.errAttr(err))
+		return
+	}
+
+	if c.log.Enabled(ctx, slog.LevelDebug) {
+		attrs := append([]any{"host", host, "uri", c.uri, "cost", time.Since(start)}, msgAttrs(body)...)
+		c.log.DebugContext(ctx, "ase once", attrs...)
+	}
+}
+
+func (c *client) logSend(ctx context.Context, req interface{}, err error) {
+	if err != nil {
+		c.log.WarnContext(ctx, "ase send failed", "host", c.streamHost(), "uri", c.uri, c.errAttr(err))
+		return
+	}
+
+	if c.log.Enabled(ctx, slog.LevelDebug) {
+		c.log.DebugContext(ctx, "ase send", frameAttrs(req)...)
+	}
+}
+
+// logReceive 记录收到的结果, 连接关闭时记录关闭原因
+func (c *client) logReceive(ctx context.Context, msg []byte, err error) {
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			c.log.DebugContext(ctx, "ase stream end", "host", c.streamHost(), "uri", c.uri)
+			return
+		}
+		var ce *CloseError
+		if errors.As(err, &ce) {
+			attrs := []any{"host", c.streamHost(), "uri", c.uri, "close_code", ce.Code, "reason", ce.Reason}
+			if ce.Engine != nil {
+				attrs = append(attrs, "code", ce.Engine.Code, "sid", ce.Engine.Sid)
+			}
+			c.log.InfoContext(ctx, "ase stream closed", attrs...)
+			return
+		}
+		c.log.WarnContext(ctx, "ase receive failed", "host", c.streamHost(), "uri", c.uri, c.errAttr(err))
+		return
+	}
+
+	if c.log.Enabled(ctx, slog.LevelDebug) {
+		c.log.DebugContext(ctx, "ase receive", msgAttrs(msg)...)
+	}
+}
@@ -0,0 +1,331 @@
+package ase
+
+import (
+	"fmt"
+	"sync"
+)
+
+// payload中承载数据的字段, 其余为格式字段
+var payloadDataFields = map[string]bool{
+	"audio": true,
+	"image": true,
+	"video": true,
+	"text":  true,
+}
+
+// MultiStreamConfig 多payload流配置
+type MultiStreamConfig struct {
+	Header    RequestHeader          // 平台参数, status 由流维护, 未设置 app_id 时使用客户端的appid
+	Parameter map[string]interface{} // 服务参数, 随首帧发送
+}
+
+// MultiStream 多payload流式会话, 每个payload key是一路独立的子流, 各自维护 status、seq 与结束.
+// Write 写入的payload暂存到 Flush 时合并为一帧发送, 同一key在一帧中只能出现一次, 重复写入时先发送暂存的帧.
+// 帧的 header.status 由各子流的状态决定: 首帧为 StatusFirstFrame, 所有子流结束时为 StatusLastFrame
+type MultiStream struct {
+	cli ASE
+	cfg MultiStreamConfig
+
+	mu      sync.Mutex
+	started bool // 已发送首帧
+	closed  bool // 已发送尾帧
+	subs    map[string]*subStream
+	order   []string // 子流的创建顺序
+	pending map[string]interface{}
+}
+
+type subStream struct {
+	seq    int
+	sent   bool        // 已发送过payload
+	ending bool        // 已调用 End, 下一个payload为最后一个
+	ended  bool        // 已发送最后一个payload
+	last   interface{} // 最近写入的payload, 用于生成不含数据的结束payload
+}
+
+// NewMultiStream 在cli的会话上创建多payload流, 结果通过 MultiStream.Receive 读取
+func NewMultiStream(cli ASE, cfg MultiStreamConfig) (*MultiStream, error) {
+	if cli == nil {
+		return nil, fmt.Errorf("nil client")
+	}
+
+	header := RequestHeader{}
+	for k, v := range cfg.Header {
+		header[k] = v
+	}
+	if _, ok := header["app_id"]; !ok {
+		if tmpl := templateOf(cli); tmpl != nil {
+			header.SetAppID(tmpl.appid)
+		}
+	}
+	cfg.Header = header
+
+	return &MultiStream{
+		cli:     cli,
+		cfg:     cfg,
+		subs:    make(map[string]*subStream),
+		pending: make(map[string]interface{}),
+	}, nil
+}
+
+// Write 暂存子流key的下一个payload, payload 支持 *AudioPayload、*TextPayload、*ImagePayload 与 map[string]interface{},
+// 其 status 与 seq 由子流设置
+func (s *MultiStream) Write(key string, payload interface{}) error {
+	if _, ok := payloadStatus(payload); !ok {
+		return fmt.Errorf("unsupported payload type %T", payload)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	sub := s.sub(key)
+	if sub.ended || sub.ending {
+		return fmt.Errorf("payload %q is ended", key)
+	}
+
+	if _, ok := s.pending[key]; ok {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+
+	s.pending[key] = payload
+	sub.last = payload
+	return nil
+}
+
+// End 结束子流key: 暂存的payload作为最后一个发送, 没有暂存时发送一个不含数据的结束payload
+func (s *MultiStream) End(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+
+	sub, ok := s.subs[key]
+	if !ok {
+		return fmt.Errorf("payload %q is not written", key)
+	}
+	if sub.ended || sub.ending {
+		return nil
+	}
+
+	sub.ending = true
+	if _, ok = s.pending[key]; !ok {
+		s.pending[key] = emptyPayload(sub.last)
+	}
+	return nil
+}
+
+// Flush 将暂存的payload合并为一帧发送
+func (s *MultiStream) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStreamClosed
+	}
+	return s.flush()
+}
+
+// Close 结束所有子流并发送尾帧, 之后继续通过 Receive 读取结果
+func (s *MultiStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	for _, key := range s.order {
+		sub := s.subs[key]
+		if sub.ended || sub.ending {
+			continue
+		}
+		sub.ending = true
+		if _, ok := s.pending[key]; !ok {
+			s.pending[key] = emptyPayload(sub.last)
+		}
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+	if !s.started {
+		// 未发送任何帧, 会话无需结束
+		s.closed = true
+		return nil
+	}
+	if !s.closed {
+		return s.send(StatusLastFrame, nil)
+	}
+	return nil
+}
+
+// Receive 读取会话结果, 错误码非0时返回 *EngineError, 结果仍随错误一并返回
+func (s *MultiStream) Receive() ([]byte, error) {
+	msg, err := s.cli.Receive()
+	if err == nil {
+		err = codeErr(msg)
+	}
+	return msg, err
+}
+
+// Stats 返回会话统计, cli未实现 StatsReporter 时为零值
+func (s *MultiStream) Stats() StreamStats {
+	if r, ok := s.cli.(StatsReporter); ok {
+		return r.Stats()
+	}
+	return StreamStats{}
+}
+
+// Destroy 关闭会话的连接
+func (s *MultiStream) Destroy() error {
+	return s.cli.Destroy()
+}
+
+func (s *MultiStream) sub(key string) *subStream {
+	sub, ok := s.subs[key]
+	if !ok {
+		sub = &subStream{}
+		s.subs[key] = sub
+		s.order = append(s.order, key)
+	}
+	return sub
+}
+
+// flush 合并发送暂存的payload, 调用方需持有锁
+func (s *MultiStream) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	payloads := make(map[string]interface{}, len(s.pending))
+	for key, p := range s.pending {
+		sub := s.subs[key]
+		status := StatusContinue
+		switch {
+		case !sub.sent && sub.ending:
+			status = StatusForOnce
+		case !sub.sent:
+			status = StatusFirstFrame
+		case sub.ending:
+			status = StatusLastFrame
+		}
+		payloads[key] = payloadWithSeq(p, status, sub.seq+1)
+	}
+
+	// 发送这一帧后是否所有子流都已结束
+	last := true
+	for key, sub := range s.subs {
+		if _, ok := s.pending[key]; !sub.ended && !(ok && sub.ending) {
+			last = false
+			break
+		}
+	}
+
+	status := StatusContinue
+	switch {
+	case !s.started:
+		status = StatusFirstFrame
+	case last:
+		status = StatusLastFrame
+	}
+	if err := s.send(status, payloads); err != nil {
+		return err
+	}
+
+	for key := range s.pending {
+		sub := s.subs[key]
+		sub.seq++
+		sub.sent = true
+		sub.ended = sub.ending
+	}
+	s.pending = make(map[string]interface{})
+
+	if last && !s.closed {
+		// 首帧不能同时是尾帧, 单独发送尾帧
+		return s.send(StatusLastFrame, nil)
+	}
+	return nil
+}
+
+// send 发送一帧, status 为 StatusLastFrame 时结束会话. 调用方需持有锁
+func (s *MultiStream) send(status int, payloads map[string]interface{}) error {
+	header := RequestHeader{}
+	for k, v := range s.cfg.Header {
+		header[k] = v
+	}
+	header.SetStatus(status)
+
+	req := new(Request)
+	req.SetHeaders(header)
+	if status == StatusFirstFrame {
+		req.SetParameters(s.cfg.Parameter)
+	}
+	if len(payloads) > 0 {
+		req.SetPayloads(payloads)
+	}
+
+	if err := s.cli.Send(req); err != nil {
+		return err
+	}
+
+	s.started = true
+	s.closed = status == StatusLastFrame
+	return nil
+}
+
+// payloadWithSeq 复制payload并设置状态与序号
+func payloadWithSeq(p interface{}, status, seq int) interface{} {
+	switch v := p.(type) {
+	case *AudioPayload:
+		out := *v
+		out.Status, out.Seq = status, seq
+		return &out
+	case *TextPayload:
+		out := *v
+		out.Status = status
+		return &out
+	case *ImagePayload:
+		out := *v
+		out.Status = status
+		return &out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, f := range v {
+			out[k] = f
+		}
+		out["status"] = status
+		out["seq"] = seq
+		return out
+	}
+	return p
+}
+
+// emptyPayload 复制payload的格式字段, 去掉数据
+func emptyPayload(p interface{}) interface{} {
+	switch v := p.(type) {
+	case *AudioPayload:
+		out := *v
+		out.Audio = ""
+		return &out
+	case *TextPayload:
+		return &TextPayload{}
+	case *ImagePayload:
+		return &ImagePayload{}
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, f := range v {
+			if !payloadDataFields[k] {
+				out[k] = f
+			}
+		}
+		return out
+	}
+	return p
+}
@@ -0,0 +1,161 @@
+package ase
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// recordingASE 记录发送的帧
+type recordingASE struct {
+	frames []string
+}
+
+func (r *recordingASE) Once(*Request) ([]byte, error)           { return nil, nil }
+func (r *recordingASE) OnceAIaaS(*AIaaSRequest) ([]byte, error) { return nil, nil }
+func (r *recordingASE) Receive() ([]byte, error)                { return nil, nil }
+func (r *recordingASE) SendAIaaS(*AIaaSRequest) error           { return nil }
+func (r *recordingASE) Destroy() error                          { return nil }
+
+// Send 将帧记录为 "header.status key:status/seq ..."
+func (r *recordingASE) Send(req *Request) error {
+	keys := make([]string, 0, len(req.Payload))
+	for k := range req.Payload {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{fmt.Sprint(toInt(req.Header["status"]))}
+	for _, k := range keys {
+		status, _ := payloadStatus(req.Payload[k])
+		seq := 0
+		switch p := req.Payload[k].(type) {
+		case *AudioPayload:
+			seq = p.Seq
+		case map[string]interface{}:
+			seq = toInt(p["seq"])
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d/%d", k, status, seq))
+	}
+	r.frames = append(r.frames, strings.Join(parts, " "))
+	return nil
+}
+
+func TestMultiStreamStatus(t *testing.T) {
+	audio := func() *AudioPayload { return &AudioPayload{Encoding: EncodingRaw, Audio: "AAAA"} }
+	video := func() map[string]interface{} {
+		return map[string]interface{}{"encoding": "h264", "video": "AAAA", "status": 0}
+	}
+
+	tests := []struct {
+		name string
+		run  func(s *MultiStream) error
+		want []string
+	}{
+		{
+			name: "sub streams end at different times",
+			run: func(s *MultiStream) error {
+				_ = s.Write("text", &TextPayload{Text: "ctx"})
+				_ = s.End("text")
+				_ = s.Write("audio", audio())
+				_ = s.Write("video", video())
+				if err := s.Flush(); err != nil {
+					return err
+				}
+				_ = s.Write("audio", audio())
+				_ = s.End("video")
+				if err := s.Flush(); err != nil {
+					return err
+				}
+				return s.Close()
+			},
+			want: []string{
+				"0 audio:0/1 text:3/0 video:0/1",
+				"1 audio:1/2 video:2/2",
+				"2 audio:2/3",
+			},
+		},
+		{
+			name: "all sub streams end in the first frame",
+			run: func(s *MultiStream) error {
+				_ = s.Write("audio", audio())
+				_ = s.End("audio")
+				return s.Flush()
+			},
+			want: []string{"0 audio:3/1", "2"},
+		},
+		{
+			name: "repeated key flushes the pending frame",
+			run: func(s *MultiStream) error {
+				_ = s.Write("audio", audio())
+				_ = s.Write("audio", audio())
+				return s.Close()
+			},
+			want: []string{"0 audio:0/1", "2 audio:2/2"},
+		},
+		{
+			name: "close without frames",
+			run: func(s *MultiStream) error {
+				return s.Close()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := &recordingASE{}
+			s, err := NewMultiStream(cli, MultiStreamConfig{Parameter: map[string]interface{}{"engine": map[string]interface{}{}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = tt.run(s); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(cli.frames) != fmt.Sprint(tt.want) {
+				t.Fatalf("frames\n%s\nwant\n%s", strings.Join(cli.frames, "\n"), strings.Join(tt.want, "\n"))
+			}
+
+			if err = s.Write("audio", audio()); err != ErrStreamClosed {
+				t.Fatalf("Write after Close: %v", err)
+			}
+		})
+	}
+}
+
+// resultASE 的 Receive 依次返回results
+type resultASE struct {
+	recordingASE
+	results [][]byte
+}
+
+func (r *resultASE) Receive() ([]byte, error) {
+	msg := r.results[0]
+	r.results = r.results[1:]
+	return msg, nil
+}
+
+func TestMultiStreamReceiveCode(t *testing.T) {
+	cli := &resultASE{results: [][]byte{
+		[]byte(`{"header":{"code":0,"status":1}}`),
+		[]byte(`{"header":{"code":10001,"message":"bad","sid":"sid","status":2}}`),
+	}}
+	s, err := NewMultiStream(cli, MultiStreamConfig{Parameter: map[string]interface{}{"engine": map[string]interface{}{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Receive(); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := s.Receive()
+	var ee *EngineError
+	if !errors.As(err, &ee) || ee.Code != 10001 || ee.Sid != "sid" {
+		t.Fatalf("err = %v, want engine error 10001", err)
+	}
+	if msg == nil {
+		t.Fatal("result is not returned with the error")
+	}
+}
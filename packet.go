@@ -0,0 +1,238 @@
+package ase
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	EncodingLame = "lame" // mp3, 按mp3帧的边界分帧发送
+	EncodingOpus = "opus" // ogg封装的opus, 按opus包的边界分帧发送
+)
+
+// packetReader 按编码包的边界读取压缩音频
+type packetReader interface {
+	// next 返回下一帧, 没有更多数据时返回 io.EOF
+	next() ([]byte, error)
+}
+
+// newPacketReader 返回原样发送的压缩格式的分帧方式, 其他格式返回nil
+func newPacketReader(r io.Reader, encoding string, frameSize int) packetReader {
+	switch encoding {
+	case EncodingLame:
+		return &mp3Reader{r: bufio.NewReader(r), size: frameSize}
+	case EncodingOpus:
+		return &oggReader{r: bufio.NewReader(r), skip: 2}
+	}
+	return nil
+}
+
+// mp3Reader 读取完整的mp3帧, 每次返回不超过size字节的若干帧(至少一帧)
+type mp3Reader struct {
+	r       *bufio.Reader
+	size    int
+	pending []byte // 超出上一次大小限制的帧
+	started bool
+}
+
+func (m *mp3Reader) next() ([]byte, error) {
+	if !m.started {
+		m.started = true
+		if err := m.skipID3(); err != nil {
+			return nil, err
+		}
+	}
+
+	out := m.pending
+	m.pending = nil
+	for {
+		frame, err := m.frame()
+		if errors.Is(err, io.EOF) {
+			if len(out) == 0 {
+				return nil, io.EOF
+			}
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if len(out) > 0 && len(out)+len(frame) > m.size {
+			m.pending = frame
+			return out, nil
+		}
+		out = append(out, frame...)
+	}
+}
+
+// skipID3 跳过文件开头的ID3v2标签
+func (m *mp3Reader) skipID3() error {
+	hdr, err := m.r.Peek(10)
+	if err != nil || string(hdr[:3]) != "ID3" {
+		return nil
+	}
+
+	// 标签大小为4个7位的syncsafe整数, 不含10字节的头部
+	size := int(hdr[6]&0x7F)<<21 | int(hdr[7]&0x7F)<<14 | int(hdr[8]&0x7F)<<7 | int(hdr[9]&0x7F)
+	if hdr[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	if _, err = m.r.Discard(10 + size); err != nil {
+		return fmt.Errorf("skip id3 tag: %w", err)
+	}
+	return nil
+}
+
+// frame 读取下一个mp3帧, 跳过帧之间无法识别的数据
+func (m *mp3Reader) frame() ([]byte, error) {
+	for {
+		hdr, err := m.r.Peek(4)
+		if len(hdr) < 4 {
+			if err == nil || errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+
+		n := mp3FrameLen(hdr)
+		if n <= 0 {
+			_, _ = m.r.Discard(1)
+			continue
+		}
+
+		frame := make([]byte, n)
+		if _, err = io.ReadFull(m.r, frame); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		return frame, nil
+	}
+}
+
+var (
+	mp3Bitrates = [2][3][16]int{
+		{ // MPEG-1, layer I/II/III
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{ // MPEG-2/2.5, layer I/II/III
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3FrameLen 根据帧头计算mp3帧的字节数, 不是有效帧头时返回0
+func mp3FrameLen(h []byte) int {
+	if h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return 0
+	}
+
+	version := (h[1] >> 3) & 0x03 // 0: MPEG-2.5, 2: MPEG-2, 3: MPEG-1
+	layer := (h[1] >> 1) & 0x03   // 1: III, 2: II, 3: I
+	bitrateIdx := h[2] >> 4
+	rateIdx := (h[2] >> 2) & 0x03
+	padding := int(h[2]>>1) & 0x01
+	if version == 1 || layer == 0 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return 0
+	}
+
+	v := 0
+	if version != 3 {
+		v = 1
+	}
+	bitrate := mp3Bitrates[v][3-layer][bitrateIdx] * 1000
+	rate := mp3SampleRates[rateIdx]
+	switch version {
+	case 2:
+		rate /= 2
+	case 0:
+		rate /= 4
+	}
+
+	switch {
+	case layer == 3: // layer I
+		return (12*bitrate/rate + padding) * 4
+	case layer == 1 && version != 3: // MPEG-2/2.5 layer III
+		return 72*bitrate/rate + padding
+	default:
+		return 144*bitrate/rate + padding
+	}
+}
+
+// oggReader 读取ogg页中的包, 每次返回一个包
+type oggReader struct {
+	r       *bufio.Reader
+	skip    int      // 跳过开头的包数, opus 的前两个包为 OpusHead 与 OpusTags
+	packets [][]byte // 已读取的完整包
+	partial []byte   // 跨页的包
+}
+
+func (o *oggReader) next() ([]byte, error) {
+	for {
+		for len(o.packets) > 0 {
+			p := o.packets[0]
+			o.packets = o.packets[1:]
+			if o.skip > 0 {
+				o.skip--
+				continue
+			}
+			return p, nil
+		}
+
+		if err := o.page(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// page 读取一个ogg页, 将其中的完整包加入packets
+func (o *oggReader) page() error {
+	var hdr [27]byte
+	if _, err := io.ReadFull(o.r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return err
+	}
+	if string(hdr[:4]) != "OggS" {
+		return fmt.Errorf("%w: invalid ogg page", ErrUnsupportedFormat)
+	}
+
+	// 页头未标记为续页时丢弃上一页未结束的包
+	if hdr[5]&0x01 == 0 {
+		o.partial = nil
+	}
+
+	segments := make([]byte, hdr[26])
+	if _, err := io.ReadFull(o.r, segments); err != nil {
+		return fmt.Errorf("read ogg page: %w", err)
+	}
+
+	total := 0
+	for _, n := range segments {
+		total += int(n)
+	}
+	body := make([]byte, total)
+	if _, err := io.ReadFull(o.r, body); err != nil {
+		return fmt.Errorf("read ogg page: %w", err)
+	}
+
+	// 长度为255的段表示包在下一段继续
+	for _, n := range segments {
+		o.partial = append(o.partial, body[:n]...)
+		body = body[n:]
+		if n < 255 {
+			o.packets = append(o.packets, o.partial)
+			o.partial = nil
+		}
+	}
+	return nil
+}
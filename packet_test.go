@@ -0,0 +1,202 @@
+package ase
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMP3FrameLen(t *testing.T) {
+	tests := []struct {
+		name string
+		hdr  []byte
+		want int
+	}{
+		{"mpeg1 layer3 128k 44.1k", []byte{0xFF, 0xFB, 0x90, 0x00}, 417},
+		{"padding", []byte{0xFF, 0xFB, 0x92, 0x00}, 418},
+		{"mpeg1 layer3 320k 48k", []byte{0xFF, 0xFB, 0xE4, 0x00}, 960},
+		{"mpeg2 layer3 64k 22.05k", []byte{0xFF, 0xF3, 0x80, 0x00}, 208},
+		{"mpeg2.5 layer3 8k 8k", []byte{0xFF, 0xE3, 0x18, 0x00}, 72},
+		{"mpeg1 layer2 128k 48k", []byte{0xFF, 0xFD, 0x84, 0x00}, 384},
+		{"mpeg1 layer1 32k 44.1k", []byte{0xFF, 0xFF, 0x10, 0x00}, 32},
+		{"no sync", []byte{0x00, 0xFB, 0x90, 0x00}, 0},
+		{"partial sync", []byte{0xFF, 0x1B, 0x90, 0x00}, 0},
+		{"reserved version", []byte{0xFF, 0xEB, 0x90, 0x00}, 0},
+		{"reserved layer", []byte{0xFF, 0xF9, 0x90, 0x00}, 0},
+		{"free bitrate", []byte{0xFF, 0xFB, 0x00, 0x00}, 0},
+		{"bad bitrate", []byte{0xFF, 0xFB, 0xF0, 0x00}, 0},
+		{"reserved sample rate", []byte{0xFF, 0xFB, 0x9C, 0x00}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mp3FrameLen(tt.hdr); got != tt.want {
+				t.Fatalf("mp3FrameLen(% x) = %d, want %d", tt.hdr, got, tt.want)
+			}
+		})
+	}
+}
+
+// mp3Frame 一个128kbps 44.1kHz的mp3帧, 帧体填充为b
+func mp3Frame(b byte) []byte {
+	frame := bytes.Repeat([]byte{b}, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	return frame
+}
+
+func TestMP3Reader(t *testing.T) {
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x00\x14"), make([]byte, 20)...)
+
+	tests := []struct {
+		name  string
+		input [][]byte
+		size  int
+		want  []int // 每次返回的帧数
+	}{
+		{"frames", [][]byte{mp3Frame(1), mp3Frame(2), mp3Frame(3)}, 417, []int{1, 1, 1}},
+		{"grouped by size", [][]byte{mp3Frame(1), mp3Frame(2), mp3Frame(3)}, 900, []int{2, 1}},
+		{"frame larger than size", [][]byte{mp3Frame(1), mp3Frame(2)}, 100, []int{1, 1}},
+		{"id3 tag", [][]byte{id3, mp3Frame(1), mp3Frame(2)}, 417, []int{1, 1}},
+		{"garbage between frames", [][]byte{{0x00, 0xFF, 0x12}, mp3Frame(1), {0xFF}, mp3Frame(2)}, 417, []int{1, 1}},
+		{"truncated last frame", [][]byte{mp3Frame(1), mp3Frame(2)[:100]}, 417, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newPacketReader(bytes.NewReader(bytes.Join(tt.input, nil)), EncodingLame, tt.size)
+
+			var got []int
+			for {
+				p, err := r.next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(p)%417 != 0 || p[0] != 0xFF {
+					t.Fatalf("packet of %d bytes is not made of whole frames", len(p))
+				}
+				got = append(got, len(p)/417)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("frames per packet %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("frames per packet %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// oggPage 生成一个ogg页, 各包按255字节分段, last为false时最后一个包在下一页继续
+func oggPage(continued bool, packets [][]byte, last bool) []byte {
+	var segments, body []byte
+	for i, p := range packets {
+		body = append(body, p...)
+		n := len(p)
+		for n >= 255 {
+			segments = append(segments, 255)
+			n -= 255
+		}
+		if i < len(packets)-1 || last {
+			segments = append(segments, byte(n))
+		} else if n > 0 {
+			panic("a continued packet must end on a 255 byte boundary")
+		}
+	}
+
+	hdr := make([]byte, 27)
+	copy(hdr, "OggS")
+	if continued {
+		hdr[5] = 0x01
+	}
+	hdr[26] = byte(len(segments))
+	return append(append(hdr, segments...), body...)
+}
+
+func TestOggReader(t *testing.T) {
+	head, tags := []byte("OpusHead"), []byte("OpusTags")
+	a := bytes.Repeat([]byte{'a'}, 10)
+	b := bytes.Repeat([]byte{'b'}, 300)
+	c := bytes.Repeat([]byte{'c'}, 255)
+	empty := []byte{}
+
+	tests := []struct {
+		name  string
+		pages [][]byte
+		want  [][]byte
+	}{
+		{
+			name:  "packets",
+			pages: [][]byte{oggPage(false, [][]byte{head}, true), oggPage(false, [][]byte{tags}, true), oggPage(false, [][]byte{a, b}, true)},
+			want:  [][]byte{a, b},
+		},
+		{
+			name: "packet across pages",
+			pages: [][]byte{
+				oggPage(false, [][]byte{head, tags, a, c}, false),
+				oggPage(true, [][]byte{b}, true),
+			},
+			want: [][]byte{a, append(append([]byte{}, c...), b...)},
+		},
+		{
+			name: "packet of exactly 255 bytes",
+			pages: [][]byte{
+				oggPage(false, [][]byte{head, tags, c, a}, true),
+			},
+			want: [][]byte{c, a},
+		},
+		{
+			name: "unfinished packet dropped",
+			pages: [][]byte{
+				oggPage(false, [][]byte{head, tags, c}, false),
+				oggPage(false, [][]byte{a}, true),
+			},
+			want: [][]byte{a},
+		},
+		{
+			name:  "empty packet",
+			pages: [][]byte{oggPage(false, [][]byte{head, tags, empty, a}, true)},
+			want:  [][]byte{empty, a},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newPacketReader(bytes.NewReader(bytes.Join(tt.pages, nil)), EncodingOpus, 0)
+
+			var got [][]byte
+			for {
+				p, err := r.next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, p)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d packets, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Fatalf("packet %d = %d bytes, want %d bytes", i, len(got[i]), len(tt.want[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestOggReaderInvalidPage(t *testing.T) {
+	r := newPacketReader(bytes.NewReader(append([]byte("RIFF"), make([]byte, 40)...)), EncodingOpus, 0)
+	if _, err := r.next(); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("err = %v, want ErrUnsupportedFormat", err)
+	}
+}
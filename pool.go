@@ -0,0 +1,267 @@
+package ase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoolMaxAge      = 5 * time.Minute  // 签名中的date与服务端时间允许的偏差
+	defaultPoolIdleTimeout = 10 * time.Second // 服务端关闭未发送数据的连接的时间
+	poolRetryInterval      = time.Second
+)
+
+// errNotConnector 会话不支持预先建连
+var errNotConnector = errors.New("session does not implement Connector")
+
+// ConnPoolConfig 连接池配置
+type ConnPoolConfig struct {
+	Size int // 保持的已建连会话数, 默认1
+
+	// MaxAge 签名的有效期, 默认5分钟
+	MaxAge time.Duration
+	// IdleTimeout 服务端关闭空闲连接的时间, 默认10秒
+	IdleTimeout time.Duration
+	// LazyRefill 到期的会话被销毁后不立即重新建连, 在 Session 取出会话后再补充, 没有流量时不占用限额与服务端的连接.
+	// 默认关闭: 会话到期后立即在后台重新建连, 始终保持 Size 个可用会话
+	LazyRefill bool
+}
+
+// ConnPool 预先建立websocket连接的会话池.
+// 创建时在后台为 Size 个会话完成签名与握手, 会话在 MaxAge 与 IdleTimeout 中较早者到期前(提前十分之一)被销毁并重新建连;
+// Session 取出未到期的会话, 池中没有时返回一个首次收发时建连的新会话.
+// 设置 LazyRefill 时到期的会话不会被替换, 按默认的 IdleTimeout 空闲9秒后池即为空, 之后的首个会话需要完整建连.
+// 池中的会话与普通会话一样占用 WithMaxConcurrentSessions 的名额.
+// 池中的会话在取出前没有读取者, 无法处理pong, 与 WithStreamPing 一起使用时 pongTimeout 需为0
+type ConnPool struct {
+	factory SessionFactory
+	cfg     ConnPoolConfig
+	ttl     time.Duration // 会话在池中可以停留的时间
+	log     *slog.Logger
+
+	mu     sync.Mutex
+	idle   []*pooledSession
+	closed bool
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type pooledSession struct {
+	sess    ASE
+	expires time.Time
+}
+
+// NewConnPool 创建会话池, 会话由cli创建, cli通常是 NewClient 返回的客户端且仅作为模板. 不再使用时需调用 Close
+func NewConnPool(cli SessionFactory, cfg ConnPoolConfig) (*ConnPool, error) {
+	if cli == nil {
+		return nil, fmt.Errorf("nil session factory")
+	}
+
+	if cfg.Size <= 0 {
+		cfg.Size = 1
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultPoolMaxAge
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultPoolIdleTimeout
+	}
+
+	ttl := cfg.MaxAge
+	if cfg.IdleTimeout < ttl {
+		ttl = cfg.IdleTimeout
+	}
+
+	p := &ConnPool{
+		factory: cli,
+		cfg:     cfg,
+		ttl:     ttl - ttl/10,
+		log:     slog.New(discardHandler{}),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if tmpl := templateOf(cli); tmpl != nil {
+		p.log = tmpl.log
+	}
+
+	p.wg.Add(1)
+	go p.fill()
+	return p, nil
+}
+
+// Session 取出一个已建连的会话, 池中没有可用会话时返回一个新会话
+func (p *ConnPool) Session() ASE {
+	p.mu.Lock()
+	expired := p.evict(time.Now())
+	var sess ASE
+	if len(p.idle) > 0 {
+		sess = p.idle[0].sess
+		p.idle[0] = nil
+		p.idle = p.idle[1:]
+	}
+	p.mu.Unlock()
+
+	destroy(expired)
+	p.signal()
+
+	if sess == nil {
+		return p.factory.Session()
+	}
+	return sess
+}
+
+// Idle 返回池中可用的会话数
+func (p *ConnPool) Idle() int {
+	p.mu.Lock()
+	expired := p.evict(time.Now())
+	n := len(p.idle)
+	p.mu.Unlock()
+
+	destroy(expired)
+	return n
+}
+
+// Close 停止建连并销毁池中的会话, 已取出的会话不受影响
+func (p *ConnPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	close(p.done)
+	p.wg.Wait()
+
+	destroy(idle)
+	return nil
+}
+
+// signal 唤醒后台goroutine补充会话
+func (p *ConnPool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// evict 取出到期的会话, 调用方需持有锁, 并在释放锁后销毁返回的会话
+func (p *ConnPool) evict(now time.Time) (expired []*pooledSession) {
+	n := 0
+	for _, ps := range p.idle {
+		if now.Before(ps.expires) {
+			p.idle[n] = ps
+			n++
+			continue
+		}
+		expired = append(expired, ps)
+	}
+	for i := n; i < len(p.idle); i++ {
+		p.idle[i] = nil
+	}
+	p.idle = p.idle[:n]
+	return
+}
+
+func destroy(sessions []*pooledSession) {
+	for _, ps := range sessions {
+		_ = ps.sess.Destroy()
+	}
+}
+
+// fill 补充会话: 创建时以及每次取出后补充到 Size 个, 未开启 LazyRefill 时会话到期后也会补充
+func (p *ConnPool) fill() {
+	defer p.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-p.done
+		cancel()
+	}()
+
+	refill := true
+	for {
+		retry := false
+		if refill {
+			if err := p.refill(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, errNotConnector) {
+					p.log.Error("ase pool disabled", "error", err.Error())
+					return
+				}
+				p.log.Warn("ase pool dial failed", "error", err.Error())
+				retry = true
+			}
+		}
+
+		// 等待下一个会话到期、重试、取出或关闭
+		var timeout <-chan time.Time
+		p.mu.Lock()
+		if len(p.idle) > 0 {
+			timeout = time.After(time.Until(p.idle[0].expires))
+		}
+		p.mu.Unlock()
+		if retry {
+			timeout = time.After(poolRetryInterval)
+		}
+
+		select {
+		case <-timeout:
+			p.mu.Lock()
+			expired := p.evict(time.Now())
+			p.mu.Unlock()
+			destroy(expired)
+			refill = retry || !p.cfg.LazyRefill
+		case <-p.wake:
+			refill = true
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *ConnPool) refill(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		expired := p.evict(time.Now())
+		n := len(p.idle)
+		p.mu.Unlock()
+		destroy(expired)
+
+		if n >= p.cfg.Size {
+			return nil
+		}
+
+		sess := p.factory.Session()
+		cn, ok := sess.(Connector)
+		if !ok {
+			_ = sess.Destroy()
+			return fmt.Errorf("%w: %T", errNotConnector, sess)
+		}
+		if err := cn.Connect(ctx); err != nil {
+			_ = sess.Destroy()
+			return err
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = sess.Destroy()
+			return ctx.Err()
+		}
+		p.idle = append(p.idle, &pooledSession{sess: sess, expires: time.Now().Add(p.ttl)})
+		p.mu.Unlock()
+	}
+}
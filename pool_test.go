@@ -0,0 +1,132 @@
+package ase
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// waitFor 轮询直到cond成立
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConnPoolSession(t *testing.T) {
+	s := newTestServer(t, drain)
+	tmpl := newTestClient(t, s, "/pool-session")
+
+	pool, err := NewConnPool(tmpl, ConnPoolConfig{Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	waitFor(t, "idle session", func() bool { return pool.Idle() == 1 })
+
+	sess := pool.Session()
+	defer sess.Destroy()
+
+	c, ok := sess.(*client)
+	if !ok {
+		t.Fatalf("session is %T", sess)
+	}
+	if c.currentConn() == nil {
+		t.Fatal("pooled session is not connected")
+	}
+	if host := c.streamHost(); host != s.host {
+		t.Fatalf("server = %q, want %q", host, s.host)
+	}
+	if err := sess.Send(testFrame(StatusFirstFrame, 1, make([]byte, 320))); err != nil {
+		t.Fatal(err)
+	}
+
+	// 取出后补充
+	waitFor(t, "refilled session", func() bool { return pool.Idle() == 1 })
+}
+
+// 池中的会话占用会话名额
+func TestConnPoolSessionLimit(t *testing.T) {
+	s := newTestServer(t, drain)
+	uri := "/pool-limit"
+	tmpl := newTestClient(t, s, uri, WithMaxConcurrentSessions(1))
+
+	pool, err := NewConnPool(tmpl, ConnPoolConfig{Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "idle session", func() bool { return pool.Idle() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if n := pool.Idle(); n != 1 {
+		t.Fatalf("idle = %d, want 1", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tmpl.sessionLimiter.acquire(ctx); err == nil {
+		t.Fatal("pooled session does not hold a session slot")
+	}
+
+	// Close 销毁池中的会话并取消等待名额的建连
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	release, err := tmpl.sessionLimiter.acquire(ctx)
+	if err != nil {
+		t.Fatalf("session slot leaked: %v", err)
+	}
+	release()
+}
+
+// 默认不在会话到期后重新建连
+func TestConnPoolExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		lazy   bool
+		redial bool
+	}{
+		{"keep warm", false, true},
+		{"lazy", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dialed atomic.Int32
+			s := newTestServer(t, func(conn *websocket.Conn) {
+				dialed.Add(1)
+				drain(conn)
+			})
+			tmpl := newTestClient(t, s, "/pool-expiry")
+
+			pool, err := NewConnPool(tmpl, ConnPoolConfig{Size: 1, IdleTimeout: 100 * time.Millisecond, LazyRefill: tt.lazy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pool.Close()
+
+			waitFor(t, "idle session", func() bool { return pool.Idle() == 1 })
+			time.Sleep(400 * time.Millisecond)
+
+			if redial := dialed.Load() > 1; redial != tt.redial {
+				t.Fatalf("dialed %d times, want redial = %v", dialed.Load(), tt.redial)
+			}
+			if tt.lazy {
+				// 到期的连接已被关闭
+				waitFor(t, "expired connection closed", func() bool { return s.active.Load() == 0 })
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package ase
+
+import (
+	"sync"
+)
+
+// OverflowPolicy 发送队列已满时的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // 阻塞直到队列有空间
+	OverflowDropOldest                       // 丢弃队列中最早的帧
+	OverflowDropNewest                       // 丢弃正在发送的帧
+	OverflowFail                             // 返回 ErrQueueFull
+)
+
+// WithStreamSendQueue 开启异步发送: Send 与 SendAIaaS 将帧放入容量为size的队列后立即返回, 由后台goroutine依次写入连接.
+// 队列已满时按policy处理; 首帧与尾帧不会被丢弃, 队列中没有可丢弃的帧时等待.
+// 异步写入的错误在之后的 Send 中返回. Destroy 时丢弃尚未发送的帧.
+// 队列长度与丢弃的帧数见 StreamStats
+func WithStreamSendQueue(size int, policy OverflowPolicy) Option {
+	return func(c *client) {
+		if size <= 0 {
+			size = 1
+		}
+		c.queueSize = size
+		c.queuePolicy = policy
+	}
+}
+
+// WithStreamDropHandler 设置发送队列丢弃帧时的回调, req 为被丢弃的 *Request 或 *AIaaSRequest
+func WithStreamDropHandler(fn func(req interface{})) Option {
+	return func(c *client) {
+		c.onDrop = fn
+	}
+}
+
+type sendQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	items   []interface{}
+	size    int
+	policy  OverflowPolicy
+	closed  bool
+	err     error // 异步写入的错误
+	dropped int
+}
+
+func newSendQueue(size int, policy OverflowPolicy) *sendQueue {
+	q := &sendQueue{size: size, policy: policy}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return q
+}
+
+// push 将帧放入队列, 返回因此被丢弃的帧
+func (q *sendQueue) push(req interface{}) (dropped interface{}, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.err != nil {
+			return nil, q.err
+		}
+		if q.closed {
+			return nil, ErrStreamClosed
+		}
+		if len(q.items) < q.size {
+			break
+		}
+
+		switch q.policy {
+		case OverflowFail:
+			return nil, ErrQueueFull
+		case OverflowDropNewest:
+			if !protectedFrame(req) {
+				q.dropped++
+				return req, nil
+			}
+			if i := q.victim(true); i >= 0 {
+				dropped = q.remove(i)
+				continue
+			}
+		case OverflowDropOldest:
+			if i := q.victim(false); i >= 0 {
+				dropped = q.remove(i)
+				continue
+			}
+			if !protectedFrame(req) {
+				q.dropped++
+				return req, nil
+			}
+		}
+
+		q.notFull.Wait()
+	}
+
+	q.items = append(q.items, req)
+	q.notEmpty.Signal()
+	return
+}
+
+// victim 查找可以丢弃的帧, newest 为true时从队尾开始查找
+func (q *sendQueue) victim(newest bool) int {
+	for n := 0; n < len(q.items); n++ {
+		i := n
+		if newest {
+			i = len(q.items) - 1 - n
+		}
+		if !protectedFrame(q.items[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *sendQueue) remove(i int) interface{} {
+	req := q.items[i]
+	q.items = append(q.items[:i], q.items[i+1:]...)
+	q.dropped++
+	return req
+}
+
+// pop 取出队首的帧, 队列关闭后返回false
+func (q *sendQueue) pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.closed {
+		return nil, false
+	}
+
+	req := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.notFull.Signal()
+	return req, true
+}
+
+// fail 记录异步写入的错误, 之后的发送均返回该错误
+func (q *sendQueue) fail(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.err = err
+	q.items = nil
+	q.notFull.Broadcast()
+}
+
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.items = nil
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *sendQueue) metrics() (depth, dropped int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items), q.dropped
+}
+
+// protectedFrame 首帧携带会话参数, 尾帧结束会话, 均不可丢弃
+func protectedFrame(req interface{}) bool {
+	status := frameStatus(req)
+	return status == StatusFirstFrame || status == StatusLastFrame
+}
+
+// enqueue 异步发送一帧
+func (c *client) enqueue(req interface{}) error {
+	dropped, err := c.queue.push(req)
+	if dropped != nil {
+		c.log.Debug("ase frame dropped", frameAttrs(dropped)...)
+		if c.onDrop != nil {
+			c.onDrop(dropped)
+		}
+	}
+	return err
+}
+
+// writeLoop 依次将队列中的帧写入连接
+func (c *client) writeLoop(queue *sendQueue) {
+	ctx := c.streamContext()
+	for {
+		req, ok := queue.pop()
+		if !ok {
+			return
+		}
+
+		if err := c.writeFrame(ctx, req); err != nil {
+			queue.fail(err)
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package ase
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// queueFrame 按 "f1"/"c2"/"l3" 生成首帧/中间帧/尾帧, 数字为seq
+func queueFrame(spec string) *Request {
+	status := map[byte]int{'f': StatusFirstFrame, 'c': StatusContinue, 'l': StatusLastFrame}[spec[0]]
+	seq, _ := strconv.Atoi(spec[1:])
+	return testFrame(status, seq, nil)
+}
+
+func queueSeq(req interface{}) int {
+	return req.(*Request).Payload["audio"].(*AudioPayload).Seq
+}
+
+func queueItems(q *sendQueue) []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seqs := make([]int, 0, len(q.items))
+	for _, req := range q.items {
+		seqs = append(seqs, queueSeq(req))
+	}
+	return seqs
+}
+
+func TestSendQueueOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  OverflowPolicy
+		pushes  []string
+		items   []int // 队列中剩余帧的seq
+		dropped []int // push 返回的被丢弃帧的seq
+		err     error // 最后一次 push 的错误
+	}{
+		{"block under capacity", OverflowBlock, []string{"f1", "c2"}, []int{1, 2}, nil, nil},
+		{"fail", OverflowFail, []string{"f1", "c2", "c3"}, []int{1, 2}, nil, ErrQueueFull},
+		{"fail protected", OverflowFail, []string{"f1", "c2", "l3"}, []int{1, 2}, nil, ErrQueueFull},
+		{"drop newest", OverflowDropNewest, []string{"f1", "c2", "c3", "c4"}, []int{1, 2}, []int{3, 4}, nil},
+		{"drop newest for last frame", OverflowDropNewest, []string{"f1", "c2", "l3"}, []int{1, 3}, []int{2}, nil},
+		{"drop newest keeps first frame", OverflowDropNewest, []string{"f1", "l2", "c3"}, []int{1, 2}, []int{3}, nil},
+		{"drop oldest", OverflowDropOldest, []string{"c1", "c2", "c3", "c4"}, []int{3, 4}, []int{1, 2}, nil},
+		{"drop oldest keeps first frame", OverflowDropOldest, []string{"f1", "c2", "c3"}, []int{1, 3}, []int{2}, nil},
+		{"drop oldest for last frame", OverflowDropOldest, []string{"f1", "c2", "l3"}, []int{1, 3}, []int{2}, nil},
+		{"drop oldest without victim", OverflowDropOldest, []string{"f1", "l2", "c3"}, []int{1, 2}, []int{3}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSendQueue(2, tt.policy)
+
+			var (
+				dropped []int
+				err     error
+			)
+			for _, spec := range tt.pushes {
+				var d interface{}
+				if d, err = q.push(queueFrame(spec)); d != nil {
+					if protectedFrame(d) {
+						t.Fatalf("dropped protected frame %d", queueSeq(d))
+					}
+					dropped = append(dropped, queueSeq(d))
+				}
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if got := queueItems(q); fmt.Sprint(got) != fmt.Sprint(tt.items) {
+				t.Fatalf("queued %v, want %v", got, tt.items)
+			}
+			if fmt.Sprint(dropped) != fmt.Sprint(tt.dropped) {
+				t.Fatalf("dropped %v, want %v", dropped, tt.dropped)
+			}
+			if _, n := q.metrics(); n != len(tt.dropped) {
+				t.Fatalf("dropped count = %d, want %d", n, len(tt.dropped))
+			}
+		})
+	}
+}
+
+// 队列中没有可丢弃的帧时 push 等待, pop、fail 与 close 均会将其唤醒
+func TestSendQueueWait(t *testing.T) {
+	errWrite := errors.New("write failed")
+	wakes := []struct {
+		name  string
+		wake  func(q *sendQueue)
+		err   error
+		items []int
+	}{
+		{"pop", func(q *sendQueue) { q.pop() }, nil, []int{2, 3}},
+		{"fail", func(q *sendQueue) { q.fail(errWrite) }, errWrite, []int{}},
+		{"close", func(q *sendQueue) { q.close() }, ErrStreamClosed, []int{}},
+	}
+	policies := []struct {
+		name   string
+		policy OverflowPolicy
+		fill   []string
+		push   string
+	}{
+		{"block", OverflowBlock, []string{"c1", "c2"}, "c3"},
+		{"drop newest", OverflowDropNewest, []string{"f1", "l2"}, "l3"},
+		{"drop oldest", OverflowDropOldest, []string{"f1", "l2"}, "l3"},
+	}
+
+	for _, p := range policies {
+		for _, w := range wakes {
+			t.Run(p.name+"/"+w.name, func(t *testing.T) {
+				q := newSendQueue(2, p.policy)
+				for _, spec := range p.fill {
+					if _, err := q.push(queueFrame(spec)); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				pushed := make(chan error, 1)
+				go func() {
+					_, err := q.push(queueFrame(p.push))
+					pushed <- err
+				}()
+
+				select {
+				case err := <-pushed:
+					t.Fatalf("push returned %v on a full queue", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+
+				w.wake(q)
+				select {
+				case err := <-pushed:
+					if !errors.Is(err, w.err) {
+						t.Fatalf("err = %v, want %v", err, w.err)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("push was not woken")
+				}
+
+				if got := queueItems(q); fmt.Sprint(got) != fmt.Sprint(w.items) {
+					t.Fatalf("queued %v, want %v", got, w.items)
+				}
+				if _, n := q.metrics(); n != 0 {
+					t.Fatalf("dropped %d frames, want 0", n)
+				}
+			})
+		}
+	}
+}
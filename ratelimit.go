@@ -0,0 +1,200 @@
+package ase
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithRateLimit 限制同一appid和uri下 Once 调用与websocket建连的速率, 所有客户端共享同一限额.
+// qps: 每秒允许的请求数; burst: 允许的突发请求数, <=0 时为1
+func WithRateLimit(qps float64, burst int) Option {
+	return func(c *client) {
+		if qps <= 0 {
+			return
+		}
+		if burst <= 0 {
+			burst = 1
+		}
+		c.limiter = sharedRateLimiter(c.limitKey(), qps, burst)
+	}
+}
+
+// WithMaxConcurrentSessions 限制同一appid和uri下同时存在的websocket会话数, 所有客户端共享同一限额.
+// 会话在建连时占用名额, 在 Destroy 时释放. 各客户端设置的n不同时以最后创建的客户端为准, 已占用的名额继续计数
+func WithMaxConcurrentSessions(n int) Option {
+	return func(c *client) {
+		if n <= 0 {
+			return
+		}
+		c.sessionLimiter = sharedSessionLimiter(c.limitKey(), n)
+	}
+}
+
+func (c *client) limitKey() string {
+	return c.appid + " " + c.uri
+}
+
+var limiters = struct {
+	sync.Mutex
+	rate     map[string]*rateLimiter
+	sessions map[string]*sessionLimiter
+}{
+	rate:     make(map[string]*rateLimiter),
+	sessions: make(map[string]*sessionLimiter),
+}
+
+func sharedRateLimiter(key string, qps float64, burst int) *rateLimiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l, ok := limiters.rate[key]
+	if !ok {
+		l = &rateLimiter{tokens: float64(burst), last: time.Now()}
+		limiters.rate[key] = l
+	}
+	l.setLimit(qps, burst)
+
+	return l
+}
+
+func sharedSessionLimiter(key string, n int) *sessionLimiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l, ok := limiters.sessions[key]
+	if !ok {
+		l = &sessionLimiter{wake: make(chan struct{})}
+		limiters.sessions[key] = l
+	}
+	l.setLimit(n)
+
+	return l
+}
+
+// rateLimiter 令牌桶限速器
+type rateLimiter struct {
+	mu     sync.Mutex
+	qps    float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) setLimit(qps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.qps, l.burst = qps, burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+}
+
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.qps
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+}
+
+// wait 预约一个令牌并等待其可用, ctx 结束时归还预约并返回错误
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.refill(now)
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.qps * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		l.cancel()
+		return context.DeadlineExceeded
+	}
+
+	tm := time.NewTimer(delay)
+	defer tm.Stop()
+
+	select {
+	case <-tm.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
+
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// sessionLimiter 并发会话数限制
+type sessionLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active int           // 已占用的名额
+	wake   chan struct{} // 名额释放或上限改变时关闭并替换, 唤醒等待者
+}
+
+// setLimit 修改上限, 超出新上限的会话不受影响, 释放后不再补充
+func (l *sessionLimiter) setLimit(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = n
+	l.notify()
+}
+
+// acquire 等待一个会话名额, 返回释放名额的函数
+func (l *sessionLimiter) acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+
+			var once sync.Once
+			return func() {
+				once.Do(l.release)
+			}, nil
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (l *sessionLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.notify()
+}
+
+// notify 唤醒所有等待者, 调用方需持有锁
+func (l *sessionLimiter) notify() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
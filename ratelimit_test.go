@@ -0,0 +1,84 @@
+package ase
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func tryAcquire(l *sessionLimiter) (func(), bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	release, err := l.acquire(ctx)
+	return release, err == nil
+}
+
+// 不同客户端设置了不同的上限时共用同一个限制器, 已占用的名额继续计数
+func TestSessionLimiterResize(t *testing.T) {
+	key := t.Name()
+	l := sharedSessionLimiter(key, 2)
+
+	r1, ok1 := tryAcquire(l)
+	r2, ok2 := tryAcquire(l)
+	if !ok1 || !ok2 {
+		t.Fatal("want 2 slots")
+	}
+
+	if l2 := sharedSessionLimiter(key, 3); l2 != l {
+		t.Fatal("limiter replaced")
+	}
+	r3, ok := tryAcquire(l)
+	if !ok {
+		t.Fatal("want the third slot after raising the limit")
+	}
+	if _, ok = tryAcquire(l); ok {
+		t.Fatal("limit exceeded")
+	}
+
+	sharedSessionLimiter(key, 1)
+	r1()
+	r2()
+	if _, ok = tryAcquire(l); ok {
+		t.Fatal("slot acquired while the session held before shrinking is still open")
+	}
+
+	r3()
+	r4, ok := tryAcquire(l)
+	if !ok {
+		t.Fatal("want a slot after all sessions are released")
+	}
+	r4()
+	r4() // 重复释放无效
+
+	r5, ok := tryAcquire(l)
+	if !ok {
+		t.Fatal("want a slot")
+	}
+	if _, ok = tryAcquire(l); ok {
+		t.Fatal("double release freed an extra slot")
+	}
+	r5()
+}
+
+func TestSessionLimiterWakesWaiter(t *testing.T) {
+	l := sharedSessionLimiter(t.Name(), 1)
+	release, _ := tryAcquire(l)
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		r, err := l.acquire(ctx)
+		if err == nil {
+			r()
+		}
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	release()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
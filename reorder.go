@@ -0,0 +1,158 @@
+package ase
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+)
+
+const defaultReorderWindow = 16
+
+// ReorderConfig 结果重排配置
+type ReorderConfig struct {
+	PayloadKey string // 结果的payload key, 默认 result
+	FirstSeq   int    // 会话首个结果的seq, 默认1
+	Window     int    // 最多缓存的乱序结果数, 默认16, 超过时放弃等待缺失的结果
+
+	OnGap       func(from, to int) // 缺失的seq区间[from, to], 在放弃等待时调用
+	OnDuplicate func(seq int)      // 重复或迟到的结果, 已被丢弃
+}
+
+// WithResultReorder 按结果payload中的seq重排 Receive 的结果: 乱序的结果被缓存到缺失的结果到达,
+// 重复的结果被丢弃, 缓存已满或收到最终结果(StatusLastFrame)时跳过缺失的seq并通知 OnGap.
+// 不含seq的结果(如错误)立即返回
+func WithResultReorder(cfg ReorderConfig) Option {
+	return func(c *client) {
+		if cfg.PayloadKey == "" {
+			cfg.PayloadKey = "result"
+		}
+		if cfg.FirstSeq <= 0 {
+			cfg.FirstSeq = 1
+		}
+		if cfg.Window <= 0 {
+			cfg.Window = defaultReorderWindow
+		}
+		c.reorderCfg = &cfg
+	}
+}
+
+// reorderer 单个会话的结果重排
+type reorderer struct {
+	cfg   *ReorderConfig
+	next  int
+	buf   map[int][]byte
+	ready [][]byte
+
+	errMsg []byte
+	err    error
+}
+
+func newReorderer(cfg *ReorderConfig) *reorderer {
+	return &reorderer{cfg: cfg, next: cfg.FirstSeq, buf: make(map[int][]byte)}
+}
+
+// receive 返回下一个按序的结果. 读取出错时先返回缓存的结果, 再返回错误
+func (r *reorderer) receive(ctx context.Context, c *client) ([]byte, error) {
+	for len(r.ready) == 0 {
+		if r.err != nil {
+			msg, err := r.errMsg, r.err
+			r.errMsg, r.err = nil, nil
+			return msg, err
+		}
+
+		msg, err := c.receiveMsg(ctx)
+		if err != nil {
+			r.errMsg, r.err = msg, err
+			r.flush()
+			continue
+		}
+		r.push(msg)
+	}
+
+	msg := r.ready[0]
+	r.ready[0] = nil
+	r.ready = r.ready[1:]
+	return msg, nil
+}
+
+func (r *reorderer) push(msg []byte) {
+	seq, status, ok := resultSeq(msg, r.cfg.PayloadKey)
+	if !ok {
+		r.ready = append(r.ready, msg)
+		return
+	}
+
+	if _, dup := r.buf[seq]; dup || seq < r.next {
+		if r.cfg.OnDuplicate != nil {
+			r.cfg.OnDuplicate(seq)
+		}
+		return
+	}
+
+	r.buf[seq] = msg
+	if status == StatusLastFrame {
+		r.flush()
+		return
+	}
+
+	r.drain()
+	for len(r.buf) > r.cfg.Window {
+		r.skip()
+	}
+}
+
+// drain 交付从next开始连续的结果
+func (r *reorderer) drain() {
+	for {
+		msg, ok := r.buf[r.next]
+		if !ok {
+			return
+		}
+		delete(r.buf, r.next)
+		r.ready = append(r.ready, msg)
+		r.next++
+	}
+}
+
+// skip 放弃等待缓存中最小seq之前缺失的结果
+func (r *reorderer) skip() {
+	seqs := make([]int, 0, len(r.buf))
+	for seq := range r.buf {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	if first := seqs[0]; first > r.next {
+		if r.cfg.OnGap != nil {
+			r.cfg.OnGap(r.next, first-1)
+		}
+		r.next = first
+	}
+	r.drain()
+}
+
+// flush 跳过所有缺失的结果, 交付全部缓存
+func (r *reorderer) flush() {
+	for len(r.buf) > 0 {
+		r.skip()
+	}
+}
+
+// resultSeq 读取结果payload中的seq与status
+func resultSeq(msg []byte, key string) (seq, status int, ok bool) {
+	var resp struct {
+		Payload map[string]struct {
+			Seq    *int `json:"seq"`
+			Status int  `json:"status"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return 0, 0, false
+	}
+
+	result, found := resp.Payload[key]
+	if !found || result.Seq == nil {
+		return 0, 0, false
+	}
+	return *result.Seq, result.Status, true
+}
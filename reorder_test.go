@@ -0,0 +1,106 @@
+package ase
+
+import (
+	"fmt"
+	"testing"
+)
+
+// seqResult 一个带seq的结果, seq<0时不含seq
+func seqResult(seq, status int) []byte {
+	if seq < 0 {
+		return []byte(`{"header":{"code":0,"status":1}}`)
+	}
+	return []byte(fmt.Sprintf(`{"payload":{"result":{"seq":%d,"status":%d}}}`, seq, status))
+}
+
+func TestReorderer(t *testing.T) {
+	type in struct{ seq, status int }
+
+	tests := []struct {
+		name   string
+		window int
+		in     []in
+		want   []int // 交付的seq, 不含seq的结果为-1
+		gaps   string
+		dups   []int
+	}{
+		{
+			name: "in order",
+			in:   []in{{1, 0}, {2, 1}, {3, 2}},
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "out of order",
+			in:   []in{{2, 1}, {3, 1}, {1, 0}, {4, 2}},
+			want: []int{1, 2, 3, 4},
+		},
+		{
+			name: "duplicate",
+			in:   []in{{1, 0}, {1, 0}, {3, 1}, {3, 1}, {2, 1}},
+			want: []int{1, 2, 3},
+			dups: []int{1, 3},
+		},
+		{
+			name:   "window overflow",
+			window: 2,
+			in:     []in{{2, 1}, {3, 1}, {4, 1}, {1, 0}, {5, 1}},
+			want:   []int{2, 3, 4, 5},
+			gaps:   "[1,1]",
+			dups:   []int{1},
+		},
+		{
+			name: "last frame flushes",
+			in:   []in{{1, 0}, {3, 1}, {6, 2}},
+			want: []int{1, 3, 6},
+			gaps: "[2,2][4,5]",
+		},
+		{
+			name: "without seq",
+			in:   []in{{2, 1}, {-1, 0}, {1, 0}},
+			want: []int{-1, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				gaps string
+				dups []int
+			)
+			cfg := &ReorderConfig{
+				PayloadKey:  "result",
+				FirstSeq:    1,
+				Window:      defaultReorderWindow,
+				OnGap:       func(from, to int) { gaps += fmt.Sprintf("[%d,%d]", from, to) },
+				OnDuplicate: func(seq int) { dups = append(dups, seq) },
+			}
+			if tt.window > 0 {
+				cfg.Window = tt.window
+			}
+
+			r := newReorderer(cfg)
+			for _, m := range tt.in {
+				r.push(seqResult(m.seq, m.status))
+			}
+
+			var got []int
+			for _, msg := range r.ready {
+				seq, _, ok := resultSeq(msg, "result")
+				if !ok {
+					seq = -1
+				}
+				got = append(got, seq)
+			}
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+			if gaps != tt.gaps {
+				t.Errorf("gaps %q, want %q", gaps, tt.gaps)
+			}
+			if fmt.Sprint(dups) != fmt.Sprint(tt.dups) {
+				t.Errorf("duplicates %v, want %v", dups, tt.dups)
+			}
+		})
+	}
+}
@@ -0,0 +1,497 @@
+package ase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultResumeRetries = 3
+
+// WithStreamResume 开启流式会话的断线续传.
+// 已发送但尚未被确定结果覆盖的帧保存在容量为 bufferFrames 的环形缓冲区中,
+// 连接中断后重新建连, 从最后一个确定片段的结束位置(结果中的 bg/ed)开始重放,
+// 并平移新连接上结果的时间戳, 使调用方看到一份连续的转写结果.
+// 时间戳的解析方式见 WithTimestampCodec, 音频时长按pcm格式计算.
+// 帧在被确认前会被保留并可能重发, 调用 Send 之后不要再修改该帧.
+// retries: 每次断线的最大重连次数, <=0 时为3
+func WithStreamResume(bufferFrames, retries int) Option {
+	return func(c *client) {
+		if retries <= 0 {
+			retries = defaultResumeRetries
+		}
+		c.resume = &resumer{
+			frames:  newFrameRing(bufferFrames),
+			retries: retries,
+		}
+	}
+}
+
+func (r *resumer) clone() *resumer {
+	if r == nil {
+		return nil
+	}
+	return &resumer{
+		frames:  newFrameRing(len(r.frames.frames)),
+		retries: r.retries,
+	}
+}
+
+type sentFrame struct {
+	data       interface{} // *Request 或 *AIaaSRequest
+	begin, end time.Duration
+	timed      bool // 帧时长是否可计算
+}
+
+// frameRing 固定容量的已发送帧缓冲区
+type frameRing struct {
+	frames     []*sentFrame
+	head, size int
+}
+
+func newFrameRing(capacity int) *frameRing {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &frameRing{frames: make([]*sentFrame, capacity)}
+}
+
+// push 追加一帧, 缓冲区已满时淘汰并返回最早的一帧
+func (r *frameRing) push(f *sentFrame) (evicted *sentFrame) {
+	if r.size == len(r.frames) {
+		evicted = r.frames[r.head]
+		r.frames[r.head] = f
+		r.head = (r.head + 1) % len(r.frames)
+		return
+	}
+
+	r.frames[(r.head+r.size)%len(r.frames)] = f
+	r.size++
+	return
+}
+
+// ack 丢弃已被确定结果完整覆盖的帧
+func (r *frameRing) ack(offset time.Duration) {
+	for r.size > 0 {
+		f := r.frames[r.head]
+		if !f.timed || f.end > offset {
+			return
+		}
+		r.frames[r.head] = nil
+		r.head = (r.head + 1) % len(r.frames)
+		r.size--
+	}
+}
+
+func (r *frameRing) list() []*sentFrame {
+	res := make([]*sentFrame, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		res = append(res, r.frames[(r.head+i)%len(r.frames)])
+	}
+	return res
+}
+
+type resumer struct {
+	mu      sync.Mutex
+	frames  *frameRing
+	retries int
+
+	first        interface{}   // 会话首帧, 重连后从中取出参数
+	sent         time.Duration // 已发送音频的总时长
+	acked        time.Duration // 已被确定结果覆盖的音频时长
+	lost         time.Duration // 因缓冲区溢出而无法重放的音频位置
+	base         time.Duration // 当前连接上第一帧音频在整个会话中的偏移
+	skip         time.Duration // 重连后丢弃结束位置不超过该偏移的结果, 它们在重连前已被确认
+	gen          int           // 连接代数, 每次重连加一
+	pendingFirst bool          // 重连后没有可重放的帧, 下一帧需按首帧发送
+	lastSent     bool
+	finished     bool
+}
+
+func (r *resumer) send(c *client, v interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c.isClosed() {
+		return c.writeConn(c.currentConn(), v)
+	}
+
+	status := frameStatus(v)
+	if r.first == nil {
+		r.first = v
+	}
+
+	out := v
+	if r.pendingFirst {
+		out = asFirstFrame(v, r.first, status)
+		r.pendingFirst = false
+	}
+
+	d, timed := frameAudioDuration(v)
+	f := &sentFrame{data: v, begin: r.sent, end: r.sent + d, timed: timed}
+	r.sent += d
+	if evicted := r.frames.push(f); evicted != nil && (!evicted.timed || evicted.end > r.acked) {
+		r.lost = evicted.end
+	}
+
+	if status == StatusLastFrame {
+		r.lastSent = true
+	}
+
+	if err := c.writeConn(c.currentConn(), out); err != nil {
+		return r.reconnect(c, err)
+	}
+
+	return nil
+}
+
+func (r *resumer) receive(c *client) ([]byte, error) {
+	for {
+		r.mu.Lock()
+		conn, gen, base := c.currentConn(), r.gen, r.base
+		r.mu.Unlock()
+
+		msg, err := c.read(conn)
+		if err == nil {
+			if msg, err = r.received(c, msg, gen, base); err != nil || msg != nil {
+				return msg, err
+			}
+			continue
+		}
+
+		r.mu.Lock()
+		switch {
+		case c.isClosed():
+		case gen != r.gen:
+			// 发送方已经完成重连
+			err = nil
+		case resumable(err):
+			err = r.reconnect(c, err)
+		}
+		r.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// received 记录确定结果覆盖的位置, 丢弃重放音频上的重复结果时返回nil
+func (r *resumer) received(c *client, msg []byte, gen int, base time.Duration) ([]byte, error) {
+	r.mu.Lock()
+	status, ok := peekStatus(msg)
+	last := ok && status == StatusLastFrame
+	if last {
+		r.finished = true
+	}
+	if seg, ok, err := c.codec.Segment(msg); err == nil && ok {
+		end := base + seg.End
+		if !last && gen > 0 && gen == r.gen && end <= r.skip {
+			r.mu.Unlock()
+			return nil, nil
+		}
+		if seg.Final && end > r.acked {
+			r.acked = end
+			r.frames.ack(end)
+		}
+	}
+	r.mu.Unlock()
+
+	if base == 0 {
+		return msg, nil
+	}
+
+	return c.codec.Shift(msg, base)
+}
+
+// reconnect 重新建连并重放未被确认的帧, 调用方需持有锁
+func (r *resumer) reconnect(c *client, cause error) error {
+	if r.finished || c.isClosed() {
+		return cause
+	}
+
+	if r.lost > r.acked {
+		return fmt.Errorf("resume buffer overflowed, audio before %s is not replayable: %w", r.lost, cause)
+	}
+
+	frames := r.frames.list()
+	if len(frames) == 0 && r.lastSent {
+		return cause
+	}
+
+	c.log.Warn("ase stream interrupted, resuming", "host", c.streamHost(), "uri", c.uri, c.errAttr(cause))
+
+	var err error
+	for i := 0; i < r.retries && !c.isClosed(); i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * 100 * time.Millisecond)
+		}
+
+		var conn *websocket.Conn
+		if conn, err = c.dial(c.streamContext()); err != nil {
+			continue
+		}
+
+		if err = r.replay(c, conn, frames); err != nil {
+			c.log.Warn("ase stream replay failed", "attempt", i+1, c.errAttr(err))
+			_ = c.closeConn(conn)
+			continue
+		}
+
+		old, ok := c.swapConn(conn)
+		if !ok {
+			// 重连期间会话已被 Destroy
+			_ = c.closeConn(conn)
+			return cause
+		}
+		_ = c.closeConn(old)
+		r.gen++
+		c.log.Info("ase stream resumed", "attempt", i+1, "replayed_frames", len(frames), "offset", r.base)
+		return nil
+	}
+
+	if err == nil {
+		// 会话已被 Destroy
+		return cause
+	}
+	return fmt.Errorf("failed to resume stream: %v: %w", err, cause)
+}
+
+func (r *resumer) replay(c *client, conn *websocket.Conn, frames []*sentFrame) error {
+	if len(frames) == 0 {
+		r.base = r.sent
+		r.pendingFirst = true
+		return nil
+	}
+
+	// 首帧可能有一部分已被确认, 从确认位置开始重放
+	first := frames[0]
+	r.base = first.begin
+	head := first.data
+	if first.timed && r.acked > first.begin {
+		var cut time.Duration
+		head, cut = trimFrame(head, r.acked-first.begin)
+		r.base += cut
+	}
+	r.skip = r.acked
+
+	r.pendingFirst = false
+	for i, f := range frames {
+		out := f.data
+		if i == 0 {
+			out = asFirstFrame(head, r.first, frameStatus(f.data))
+		}
+
+		if err := c.writeConn(conn, out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resumable 连接是否为意外中断, 取消、超时与已关闭的连接不重连
+func resumable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, net.ErrClosed) {
+		return false
+	}
+
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		return true
+	}
+
+	switch ce.Code {
+	case websocket.CloseAbnormalClosure, websocket.CloseGoingAway, websocket.CloseServiceRestart,
+		websocket.CloseTryAgainLater, websocket.CloseInternalServerErr:
+		return true
+	}
+	return false
+}
+
+// trimFrame 复制v并去掉pcm音频开头时长为d的部分, 按采样对齐, 返回实际去掉的时长
+func trimFrame(v interface{}, d time.Duration) (out interface{}, cut time.Duration) {
+	trim := func(format AudioFormat, audio string) (string, bool) {
+		raw, err := base64.StdEncoding.DecodeString(audio)
+		if err != nil || !format.IsPCM() {
+			return "", false
+		}
+
+		n := format.Bytes(d)
+		if n > len(raw) {
+			n = len(raw)
+		}
+		if c := format.Duration(n); c > cut {
+			cut = c
+		}
+		return base64.StdEncoding.EncodeToString(raw[n:]), true
+	}
+
+	switch req := v.(type) {
+	case *Request:
+		cp := *req
+		cp.Payload = make(map[string]interface{}, len(req.Payload))
+		for k, p := range req.Payload {
+			cp.Payload[k] = p
+			if format, audio, ok := audioOf(p); ok {
+				if audio, ok = trim(format, audio); ok {
+					cp.Payload[k] = payloadWithAudio(p, audio)
+				}
+			}
+		}
+		return &cp, cut
+	case *AIaaSRequest:
+		audio, ok := req.Data["audio"].(string)
+		if !ok {
+			return v, 0
+		}
+		format, _ := req.Data["format"].(string)
+		if audio, ok = trim(parseAIaaSFormat(format), audio); !ok {
+			return v, 0
+		}
+
+		cp := *req
+		cp.Data = make(map[string]interface{}, len(req.Data))
+		for k, d := range req.Data {
+			cp.Data[k] = d
+		}
+		cp.Data["audio"] = audio
+		return &cp, cut
+	}
+
+	return v, 0
+}
+
+func payloadWithAudio(p interface{}, audio string) interface{} {
+	switch v := p.(type) {
+	case *AudioPayload:
+		cp := *v
+		cp.Audio = audio
+		return &cp
+	case AudioPayload:
+		v.Audio = audio
+		return &v
+	case map[string]interface{}:
+		cp := make(map[string]interface{}, len(v))
+		for k, f := range v {
+			cp[k] = f
+		}
+		cp["audio"] = audio
+		return cp
+	}
+	return p
+}
+
+// frameStatus 读取请求帧的状态
+func frameStatus(v interface{}) int {
+	switch req := v.(type) {
+	case *Request:
+		return toInt(req.Header["status"])
+	case *AIaaSRequest:
+		return toInt(req.Data["status"])
+	}
+	return StatusContinue
+}
+
+// asFirstFrame 复制v并改写为会话首帧, 参数取自会话原始首帧first; 原帧为尾帧时保留尾帧状态
+func asFirstFrame(v, first interface{}, status int) interface{} {
+	if status != StatusLastFrame {
+		status = StatusFirstFrame
+	}
+
+	switch req := v.(type) {
+	case *Request:
+		out := &Request{
+			Header:    RequestHeader{},
+			Parameter: req.Parameter,
+			Payload:   make(map[string]interface{}, len(req.Payload)),
+		}
+		if f, ok := first.(*Request); ok {
+			for k, h := range f.Header {
+				out.Header[k] = h
+			}
+			out.Parameter = f.Parameter
+		}
+		for k, h := range req.Header {
+			out.Header[k] = h
+		}
+		out.Header.SetStatus(status)
+		for k, p := range req.Payload {
+			out.Payload[k] = payloadWithStatus(p, status)
+		}
+		return out
+	case *AIaaSRequest:
+		out := &AIaaSRequest{
+			Common:   req.Common,
+			Business: req.Business,
+			Data:     make(map[string]interface{}, len(req.Data)),
+		}
+		if f, ok := first.(*AIaaSRequest); ok {
+			out.Common, out.Business = f.Common, f.Business
+		}
+		for k, d := range req.Data {
+			out.Data[k] = d
+		}
+		out.Data["status"] = status
+		return out
+	}
+
+	return v
+}
+
+func payloadWithStatus(p interface{}, status int) interface{} {
+	switch v := p.(type) {
+	case *AudioPayload:
+		cp := *v
+		cp.Status = status
+		return &cp
+	case *TextPayload:
+		cp := *v
+		cp.Status = status
+		return &cp
+	case *ImagePayload:
+		cp := *v
+		cp.Status = status
+		return &cp
+	case map[string]interface{}:
+		cp := make(map[string]interface{}, len(v))
+		for k, f := range v {
+			cp[k] = f
+		}
+		if _, ok := v["status"]; ok {
+			cp["status"] = status
+		}
+		return cp
+	}
+	return p
+}
+
+// peekStatus 读取结果中 header.status (ASE) 或 data.status (AIaaS)
+func peekStatus(msg []byte) (status int, ok bool) {
+	var resp struct {
+		Header *struct {
+			Status *int `json:"status"`
+		} `json:"header"`
+		Data *struct {
+			Status *int `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(msg, &resp); err != nil {
+		return 0, false
+	}
+
+	switch {
+	case resp.Header != nil && resp.Header.Status != nil:
+		return *resp.Header.Status, true
+	case resp.Data != nil && resp.Data.Status != nil:
+		return *resp.Data.Status, true
+	}
+	return 0, false
+}
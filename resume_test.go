@@ -0,0 +1,241 @@
+package ase
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testResult 一个带时间戳的识别结果, 时间单位为毫秒
+func testResult(bg, ed int64, status int) []byte {
+	text, _ := json.Marshal(map[string]int64{"bg": bg, "ed": ed})
+	msg, _ := json.Marshal(map[string]interface{}{
+		"header": map[string]interface{}{"code": 0, "status": status},
+		"payload": map[string]interface{}{
+			"result": map[string]interface{}{"text": base64.StdEncoding.EncodeToString(text)},
+		},
+	})
+	return msg
+}
+
+// replayedFrame 服务端收到的一帧
+type replayedFrame struct {
+	status    int
+	parameter bool
+	audio     []byte
+}
+
+func readTestFrame(conn *websocket.Conn) (f replayedFrame, err error) {
+	var req struct {
+		Header    map[string]interface{} `json:"header"`
+		Parameter map[string]interface{} `json:"parameter"`
+		Payload   struct {
+			Audio AudioPayload `json:"audio"`
+		} `json:"payload"`
+	}
+	if err = conn.ReadJSON(&req); err != nil {
+		return
+	}
+
+	f.status = toInt(req.Header["status"])
+	f.parameter = len(req.Parameter) > 0
+	f.audio, err = base64.StdEncoding.DecodeString(req.Payload.Audio.Audio)
+	return
+}
+
+// 断线后从最后一个确定结果的结束位置重放, 首帧中已被确认的部分不再发送
+func TestResumeReplay(t *testing.T) {
+	const frame = 1280 // 40ms
+
+	var (
+		conns    atomic.Int32
+		mu       sync.Mutex
+		replayed []replayedFrame
+	)
+	s := newTestServer(t, func(conn *websocket.Conn) {
+		switch conns.Add(1) {
+		case 1:
+			for i := 0; i < 3; i++ {
+				if _, err := readTestFrame(conn); err != nil {
+					return
+				}
+			}
+			// 确认前60ms后意外断开
+			_ = conn.WriteMessage(websocket.TextMessage, testResult(0, 60, StatusContinue))
+			_ = conn.UnderlyingConn().Close()
+		case 2:
+			for {
+				f, err := readTestFrame(conn)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				first := len(replayed) == 0
+				replayed = append(replayed, f)
+				mu.Unlock()
+
+				if first {
+					// 结束位置不超过已确认位置的结果是重复的
+					_ = conn.WriteMessage(websocket.TextMessage, testResult(0, 0, StatusContinue))
+					_ = conn.WriteMessage(websocket.TextMessage, testResult(0, 40, StatusContinue))
+				}
+				if f.status == StatusLastFrame {
+					_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"header":{"code":0,"status":2}}`))
+					drain(conn)
+					return
+				}
+			}
+		default:
+			drain(conn)
+		}
+	})
+
+	c := newTestClient(t, s, "/resume", WithStreamResume(16, 3))
+	defer c.Destroy()
+
+	send := func(status, seq int) {
+		t.Helper()
+		if err := c.Send(testFrame(status, seq, bytes.Repeat([]byte{byte(seq)}, frame))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(StatusFirstFrame, 1)
+	send(StatusContinue, 2)
+	send(StatusContinue, 3)
+
+	msg, err := c.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seg, _, _ := c.codec.Segment(msg); seg.End != 60*time.Millisecond {
+		t.Fatalf("first result ends at %s", seg.End)
+	}
+
+	results := make(chan []byte, 8)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(results)
+		for {
+			msg, err := c.Receive()
+			if err != nil {
+				errc <- err
+				return
+			}
+			results <- msg
+			if status, _ := peekStatus(msg); status == StatusLastFrame {
+				return
+			}
+		}
+	}()
+
+	send(StatusContinue, 4)
+	send(StatusLastFrame, 5)
+
+	var segs []Segment
+	for msg := range results {
+		if seg, ok, _ := c.codec.Segment(msg); ok {
+			segs = append(segs, seg)
+		}
+	}
+	select {
+	case err := <-errc:
+		t.Fatal(err)
+	default:
+	}
+
+	want := []Segment{{Begin: 60 * time.Millisecond, End: 100 * time.Millisecond, Final: true}}
+	if fmt.Sprint(segs) != fmt.Sprint(want) {
+		t.Fatalf("results after resume = %v, want %v", segs, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(replayed) != 4 {
+		t.Fatalf("replayed %d frames, want 4", len(replayed))
+	}
+	first := replayed[0]
+	if first.status != StatusFirstFrame || !first.parameter {
+		t.Fatalf("first replayed frame: status %d, parameter %v", first.status, first.parameter)
+	}
+	if !bytes.Equal(first.audio, bytes.Repeat([]byte{2}, frame/2)) {
+		t.Fatalf("first replayed frame has %d bytes of audio, want the last 20ms of frame 2", len(first.audio))
+	}
+	for i, f := range replayed[1:] {
+		if seq := i + 3; !bytes.Equal(f.audio, bytes.Repeat([]byte{byte(seq)}, frame)) {
+			t.Fatalf("replayed frame %d does not carry frame %d", i+1, seq)
+		}
+	}
+}
+
+func TestResumable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"eof", io.ErrUnexpectedEOF, true},
+		{"abnormal closure", &websocket.CloseError{Code: websocket.CloseAbnormalClosure}, true},
+		{"try again later", &websocket.CloseError{Code: websocket.CloseTryAgainLater}, true},
+		{"pong timeout", ErrPongTimeout, true},
+		{"normal closure", &websocket.CloseError{Code: websocket.CloseNormalClosure}, false},
+		{"canceled", fmt.Errorf("dial: %w", context.Canceled), false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"closed conn", &net.OpError{Op: "read", Err: net.ErrClosed}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resumable(tt.err); got != tt.want {
+				t.Fatalf("resumable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimFrame(t *testing.T) {
+	audio := make([]byte, 1280)
+	for i := range audio {
+		audio[i] = byte(i)
+	}
+
+	tests := []struct {
+		name    string
+		trim    time.Duration
+		cut     time.Duration
+		samples int
+	}{
+		{"none", 0, 0, 640},
+		{"half", 20 * time.Millisecond, 20 * time.Millisecond, 320},
+		{"sample aligned", 20*time.Millisecond + 30*time.Microsecond, 20 * time.Millisecond, 320},
+		{"all", time.Second, 40 * time.Millisecond, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testFrame(StatusContinue, 2, audio)
+			out, cut := trimFrame(req, tt.trim)
+			if cut != tt.cut {
+				t.Fatalf("cut = %s, want %s", cut, tt.cut)
+			}
+
+			p := out.(*Request).Payload["audio"].(*AudioPayload)
+			got, _ := base64.StdEncoding.DecodeString(p.Audio)
+			if !bytes.Equal(got, audio[len(audio)-tt.samples*2:]) {
+				t.Fatalf("kept %d bytes, want the last %d samples", len(got), tt.samples)
+			}
+			if p == req.Payload["audio"] {
+				t.Fatal("trimFrame modified the original frame")
+			}
+		})
+	}
+}
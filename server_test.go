@@ -0,0 +1,98 @@
+package ase
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer 本地websocket服务端, 每条连接由handler处理
+type testServer struct {
+	*httptest.Server
+	host   string
+	active atomic.Int32 // 尚未关闭的连接数
+}
+
+func newTestServer(t *testing.T, handler func(conn *websocket.Conn)) *testServer {
+	t.Helper()
+
+	s := &testServer{}
+	upgrader := websocket.Upgrader{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		s.active.Add(1)
+		defer func() {
+			_ = conn.Close()
+			s.active.Add(-1)
+		}()
+
+		handler(conn)
+	}))
+	s.host = strings.TrimPrefix(s.URL, "http://")
+
+	t.Cleanup(func() {
+		s.Close()
+		s.waitIdle(t)
+	})
+	return s
+}
+
+// waitIdle 等待服务端的所有连接被关闭
+func (s *testServer) waitIdle(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.active.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections are still open", s.active.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// drain 读取连接上的所有帧直到连接关闭
+func drain(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func newTestClient(t *testing.T, s *testServer, uri string, opts ...Option) *client {
+	t.Helper()
+
+	cli, err := NewClient("appid", "key", "secret", s.host, uri, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli.(*client)
+}
+
+// testFrame 一帧携带音频的请求
+func testFrame(status, seq int, audio []byte) *Request {
+	req := &Request{Header: RequestHeader{"app_id": "appid", "status": status}}
+	if status == StatusFirstFrame {
+		req.SetParameter("engine", map[string]interface{}{"lang": "cn"})
+	}
+	req.SetAudioPayload("audio", &AudioPayload{
+		Encoding:   EncodingRaw,
+		SampleRate: 16000,
+		Channels:   1,
+		BitDepth:   16,
+		Status:     status,
+		Seq:        seq,
+		Audio:      base64.StdEncoding.EncodeToString(audio),
+	})
+	return req
+}
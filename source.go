@@ -0,0 +1,382 @@
+package ase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Source 流式请求的来源, 见 Runner.Run
+type Source interface {
+	// Next 返回下一帧, header.status 为 StatusLastFrame 的帧是最后一帧; 没有更多帧时返回 io.EOF
+	Next(ctx context.Context) (*Request, error)
+}
+
+// AudioSourceConfig 音频来源配置
+type AudioSourceConfig struct {
+	Header     RequestHeader          // 平台参数, status 由来源维护, 未设置 app_id 时由 Run 使用客户端的appid
+	Parameter  map[string]interface{} // 服务参数, 随首帧发送
+	PayloadKey string                 // 音频数据的payload key, 默认 audio
+	Format     AudioFormat            // 音频格式, 压缩格式见 RegisterDecoder、EncodingLame 与 EncodingOpus
+	Target     AudioFormat            // 发送的pcm格式, 设置时将 Format 格式的音频转换为该格式, 见 ConvertAudio
+	FrameSize  int                    // 每帧音频的字节数, 默认为40ms的pcm音频, 非pcm格式为1280; EncodingOpus 每帧为一个包
+	Interval   time.Duration          // 发送间隔, 默认不等待
+	VAD        *VADConfig             // 语音检测, 去掉静音并在语音结束时发送尾帧, 默认关闭
+
+	// StallTimeout 超过该时长未读取到音频时发送一帧静音, 避免服务端因超时结束会话, 默认关闭; 仅支持pcm.
+	// 插入的帧数见 StreamStats.FramesInjected
+	StallTimeout time.Duration
+}
+
+// AudioSource 从io.Reader中按 FrameSize 读取音频, 依次生成首帧、中间帧与尾帧.
+// 注册了解码器的格式先解码为pcm; EncodingLame 与 EncodingOpus 原样发送, 按编码包的边界分帧.
+// 开启 StallTimeout 时音频由后台goroutine读取, 它在首次调用 Next 的ctx结束或 Close 后退出; Runner.Run 返回前会关闭来源
+type AudioSource struct {
+	r       io.Reader
+	packets packetReader // 压缩音频的分帧, pcm为nil
+	vad     *vad
+	cfg     AudioSourceConfig
+
+	err      error // 创建时的错误, 由 Next 返回
+	seq      int
+	pos      time.Duration     // 已读取的源音频时长
+	frames   chan sourceResult // StallTimeout 开启时由后台goroutine读取音频
+	ready    []sourceFrame     // 待发送的帧
+	next     *sourceFrame      // 预读的下一帧, 用于判断当前帧是否为尾帧
+	drained  bool              // 音频已读取完毕或语音已结束
+	eof      bool
+	done     bool
+	last     time.Time
+	times    timeMap
+	injected bool // Next 最近返回的帧是插入的静音
+
+	closed    chan struct{} // Close 时关闭, 通知后台goroutine退出
+	closeOnce sync.Once
+	loopErr   error // 后台goroutine提前退出的原因, 在 frames 关闭后读取
+}
+
+type sourceResult struct {
+	data []byte
+	err  error
+}
+
+// NewAudioSource 创建读取r中音频的来源
+func NewAudioSource(r io.Reader, cfg AudioSourceConfig) *AudioSource {
+	if cfg.PayloadKey == "" {
+		cfg.PayloadKey = defaultAudioPayloadKey
+	}
+	if cfg.Format.Encoding == "" {
+		cfg.Format.Encoding = EncodingRaw
+	}
+
+	r, format, err := decode(r, cfg.Format)
+	if err == nil {
+		cfg.Format = format
+	}
+
+	switch {
+	case err != nil:
+	case cfg.Target.SampleRate > 0:
+		if r, err = ConvertAudio(r, cfg.Format, cfg.Target); err == nil {
+			cfg.Format = cfg.Target
+			cfg.Format.Encoding = EncodingRaw
+		}
+	case needsConversion(cfg.Format.Encoding):
+		err = fmt.Errorf("%w: %s audio must be converted, set AudioSourceConfig.Target", ErrUnsupportedFormat, cfg.Format.Encoding)
+	}
+	if err == nil && cfg.VAD != nil && !cfg.Format.IsPCM() {
+		err = fmt.Errorf("%w: vad requires pcm audio, got %+v", ErrUnsupportedFormat, cfg.Format)
+	}
+	if err == nil && cfg.StallTimeout > 0 && !cfg.Format.IsPCM() {
+		err = fmt.Errorf("%w: silence keepalive requires pcm audio, got %+v", ErrUnsupportedFormat, cfg.Format)
+	}
+	if cfg.FrameSize <= 0 {
+		cfg.FrameSize = cfg.Format.Bytes(defaultFrameDuration)
+	}
+	if cfg.FrameSize <= 0 {
+		cfg.FrameSize = defaultFrameSize
+	}
+
+	s := &AudioSource{
+		r:       r,
+		packets: newPacketReader(r, cfg.Format.Encoding, cfg.FrameSize),
+		cfg:     cfg,
+		err:     err,
+		closed:  make(chan struct{}),
+	}
+	if cfg.VAD != nil {
+		s.vad = newVAD(*cfg.VAD, cfg.Format)
+	}
+	return s
+}
+
+// needsConversion 引擎不接受的输入格式
+func needsConversion(encoding string) bool {
+	switch encoding {
+	case EncodingFloat, EncodingMuLaw, EncodingALaw:
+		return true
+	}
+	return false
+}
+
+// Format 返回音频格式
+func (s *AudioSource) Format() AudioFormat {
+	return s.cfg.Format
+}
+
+// Close 停止后台读取音频的goroutine, 之后 Next 返回 ErrStreamClosed. 不会关闭底层的io.Reader,
+// 阻塞在读取中的goroutine在读取返回后退出
+func (s *AudioSource) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+func (s *AudioSource) Next(ctx context.Context) (*Request, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	select {
+	case <-s.closed:
+		return nil, ErrStreamClosed
+	default:
+	}
+	if s.done {
+		return nil, io.EOF
+	}
+
+	if err := s.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	if s.next == nil && !s.eof {
+		if err := s.read(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if s.seq == 0 && s.next == nil {
+		// 没有任何音频
+		s.done = true
+		return nil, io.EOF
+	}
+
+	var frame sourceFrame
+	if s.next != nil {
+		frame = *s.next
+	}
+	s.next = nil
+	if !s.eof {
+		if err := s.read(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	status := StatusContinue
+	switch {
+	case s.seq == 0:
+		// 首帧不能同时是尾帧, 音频只有一帧时之后再发送不含音频的尾帧
+		status = StatusFirstFrame
+	case s.eof && s.next == nil:
+		status = StatusLastFrame
+		s.done = true
+	}
+
+	s.injected = frame.injected
+	return s.frame(frame.data, status), nil
+}
+
+// read 预读下一帧, 没有更多帧时设置eof
+func (s *AudioSource) read(ctx context.Context) error {
+	for len(s.ready) == 0 && !s.drained {
+		data, injected, err := s.readFrame(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case injected:
+			// 插入的静音不经过语音检测, 不占用源音频的时间
+			s.ready = append(s.ready, sourceFrame{data: data, pos: s.pos, injected: true})
+		case data == nil:
+			s.drained = true
+		case s.vad == nil:
+			s.ready = append(s.ready, sourceFrame{data: data, pos: s.pos})
+			s.pos += s.cfg.Format.Duration(len(data))
+		default:
+			var out []sourceFrame
+			out, s.drained = s.vad.push(data)
+			s.ready = append(s.ready, out...)
+			s.pos += s.cfg.Format.Duration(len(data))
+		}
+	}
+
+	if len(s.ready) == 0 {
+		s.eof = true
+		return nil
+	}
+
+	f := s.ready[0]
+	s.ready[0] = sourceFrame{}
+	s.ready = s.ready[1:]
+	s.next = &f
+	s.times.record(f.pos, s.cfg.Format.Duration(len(f.data)))
+	return nil
+}
+
+// readFrame 读取一帧音频, 读到结尾时返回nil. 开启 StallTimeout 时超时未读取到音频返回一帧静音,
+// 开启语音检测时在检测到语音之前不插入静音
+func (s *AudioSource) readFrame(ctx context.Context) (data []byte, injected bool, err error) {
+	if s.cfg.StallTimeout <= 0 {
+		data, err = s.readRaw()
+		return data, false, err
+	}
+
+	if s.frames == nil {
+		s.frames = make(chan sourceResult, 1)
+		go s.readLoop(ctx)
+	}
+
+	tm := time.NewTimer(s.cfg.StallTimeout)
+	defer tm.Stop()
+
+	for {
+		select {
+		case r, ok := <-s.frames:
+			if !ok {
+				return nil, false, s.loopErr
+			}
+			return r.data, false, r.err
+		case <-tm.C:
+			if s.vad == nil || s.vad.started {
+				return silence(s.cfg.Format, s.cfg.FrameSize), true, nil
+			}
+			tm.Reset(s.cfg.StallTimeout)
+		case <-s.closed:
+			return nil, false, ErrStreamClosed
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// readLoop 在后台读取音频直到结尾、出错、来源被关闭或ctx结束
+func (s *AudioSource) readLoop(ctx context.Context) {
+	defer close(s.frames)
+
+	for {
+		data, err := s.readRaw()
+		if data == nil && err == nil {
+			return
+		}
+
+		select {
+		case s.frames <- sourceResult{data: data, err: err}:
+		case <-s.closed:
+			s.loopErr = ErrStreamClosed
+			return
+		case <-ctx.Done():
+			s.loopErr = ctx.Err()
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readRaw 从源读取一帧音频, 读到结尾时返回nil
+func (s *AudioSource) readRaw() ([]byte, error) {
+	if s.packets != nil {
+		p, err := s.packets.next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read audio: %w", err)
+		}
+		return p, nil
+	}
+
+	buf := make([]byte, s.cfg.FrameSize)
+	n, err := io.ReadFull(s.r, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("read audio: %w", err)
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+	return buf[:n], nil
+}
+
+// silence 返回n字节的pcm静音, 8bit音频为无符号
+func silence(f AudioFormat, n int) []byte {
+	b := make([]byte, n)
+	if f.BitDepth == 8 {
+		for i := range b {
+			b[i] = 0x80
+		}
+	}
+	return b
+}
+
+// offsetAt 返回已发送音频中t时刻对应的源音频偏移, 用于还原跳过静音或插入静音后的结果时间戳
+func (s *AudioSource) offsetAt(t time.Duration) time.Duration {
+	return s.times.offsetAt(t)
+}
+
+// wasInjected 最近一次 Next 返回的帧是否为插入的静音
+func (s *AudioSource) wasInjected() bool {
+	return s.injected
+}
+
+// wait 按 Interval 控制发送速度
+func (s *AudioSource) wait(ctx context.Context) error {
+	if s.cfg.Interval <= 0 || s.last.IsZero() {
+		s.last = time.Now()
+		return nil
+	}
+
+	tm := time.NewTimer(time.Until(s.last.Add(s.cfg.Interval)))
+	defer tm.Stop()
+
+	select {
+	case <-tm.C:
+		s.last = time.Now()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *AudioSource) frame(audio []byte, status int) *Request {
+	s.seq++
+
+	header := RequestHeader{}
+	for k, v := range s.cfg.Header {
+		header[k] = v
+	}
+	header.SetStatus(status)
+
+	req := new(Request)
+	req.SetHeaders(header)
+	if status == StatusFirstFrame {
+		req.SetParameters(s.cfg.Parameter)
+	}
+	req.SetAudioPayload(s.cfg.PayloadKey, &AudioPayload{
+		Encoding:   s.cfg.Format.Encoding,
+		SampleRate: s.cfg.Format.SampleRate,
+		Channels:   s.cfg.Format.Channels,
+		BitDepth:   s.cfg.Format.BitDepth,
+		Status:     status,
+		Seq:        s.seq,
+		Audio:      base64.StdEncoding.EncodeToString(audio),
+		FrameSize:  s.cfg.FrameSize,
+	})
+	return req
+}
@@ -0,0 +1,115 @@
+package ase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+var pcm16k = AudioFormat{Encoding: EncodingRaw, SampleRate: 16000, Channels: 1, BitDepth: 16}
+
+// 后台读取音频的goroutine在 Close 或ctx结束后退出, 不会阻塞在发送上
+func TestAudioSourceReadLoopExits(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(s *AudioSource, cancel context.CancelFunc)
+		want error
+	}{
+		{"close", func(s *AudioSource, _ context.CancelFunc) { _ = s.Close() }, ErrStreamClosed},
+		{"context", func(_ *AudioSource, cancel context.CancelFunc) { cancel() }, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw := io.Pipe()
+			defer pr.Close()
+			go func() {
+				// 源源不断的音频, 读取方不再接收后阻塞在发送上
+				for {
+					if _, err := pw.Write(make([]byte, 1280)); err != nil {
+						return
+					}
+				}
+			}()
+
+			s := NewAudioSource(pr, AudioSourceConfig{Format: pcm16k, StallTimeout: time.Second})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if _, err := s.Next(ctx); err != nil {
+				t.Fatal(err)
+			}
+			tt.stop(s, cancel)
+
+			deadline := time.After(5 * time.Second)
+			for {
+				select {
+				case _, ok := <-s.frames:
+					if !ok {
+						if !errors.Is(s.loopErr, tt.want) {
+							t.Fatalf("loop exited with %v, want %v", s.loopErr, tt.want)
+						}
+						return
+					}
+				case <-deadline:
+					t.Fatal("read loop did not exit")
+				}
+			}
+		})
+	}
+}
+
+func TestAudioSourceNextAfterClose(t *testing.T) {
+	s := NewAudioSource(io.LimitReader(zeroReader{}, 12800), AudioSourceConfig{Format: pcm16k})
+	_ = s.Close()
+
+	if _, err := s.Next(context.Background()); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("err = %v, want ErrStreamClosed", err)
+	}
+}
+
+// 开启语音检测时, 检测到语音之前不插入静音
+func TestAudioSourceStallBeforeSpeech(t *testing.T) {
+	tests := []struct {
+		name     string
+		vad      *VADConfig
+		injected bool
+	}{
+		{"without vad", nil, true},
+		{"vad waiting for speech", &VADConfig{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw := io.Pipe()
+			defer pw.Close()
+
+			s := NewAudioSource(pr, AudioSourceConfig{Format: pcm16k, StallTimeout: 20 * time.Millisecond, VAD: tt.vad})
+			defer s.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			_, err := s.Next(ctx)
+			switch {
+			case tt.injected && err != nil:
+				t.Fatal(err)
+			case tt.injected && !s.wasInjected():
+				t.Fatal("no silence injected")
+			case !tt.injected && !errors.Is(err, context.DeadlineExceeded):
+				t.Fatalf("err = %v, want to keep waiting for audio", err)
+			}
+		})
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -0,0 +1,123 @@
+package ase
+
+import (
+	"sync"
+	"time"
+)
+
+// StreamStats 流式会话的统计
+type StreamStats struct {
+	Sid string // 服务端会话id
+
+	HandshakeDuration   time.Duration // 建连(含TLS与websocket握手)耗时
+	TimeToFirstResponse time.Duration // 首帧发送到收到首个结果的耗时
+	FinalLatency        time.Duration // 发送 StatusLastFrame 到收到最终结果的耗时
+	RTT                 time.Duration // 最近一次ping到pong的往返时间, 见 WithStreamPing
+
+	AudioSent      time.Duration // 已发送的音频时长, 按pcm格式计算
+	RealTimeFactor float64       // 处理耗时(首帧发送到最终结果, 未结束时到当前)与音频时长之比
+
+	FramesSent     int
+	FramesReceived int
+	BytesSent      int64 // 已发送的音频字节数
+	BytesReceived  int64
+
+	QueueDepth     int // 异步发送队列中等待发送的帧数, 见 WithStreamSendQueue
+	FramesDropped  int // 发送队列已满时丢弃的帧数
+	FramesInjected int // 音频来源停顿时插入的静音帧数, 见 AudioSourceConfig.StallTimeout
+}
+
+// sessionStats 收集流式会话的统计
+type sessionStats struct {
+	mu sync.Mutex
+	s  StreamStats
+
+	firstSent time.Time
+	lastSent  time.Time // 发送 StatusLastFrame 的时间
+	firstRecv time.Time
+	finalRecv time.Time
+}
+
+func (st *sessionStats) handshake(d time.Duration) {
+	st.mu.Lock()
+	st.s.HandshakeDuration = d
+	st.mu.Unlock()
+}
+
+func (st *sessionStats) rtt(d time.Duration) {
+	st.mu.Lock()
+	st.s.RTT = d
+	st.mu.Unlock()
+}
+
+func (st *sessionStats) inject() {
+	st.mu.Lock()
+	st.s.FramesInjected++
+	st.mu.Unlock()
+}
+
+func (st *sessionStats) send(req interface{}) {
+	status, _, size := frameMeta(req)
+	d, _ := frameAudioDuration(req)
+	now := time.Now()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.firstSent.IsZero() {
+		st.firstSent = now
+	}
+	if status == StatusLastFrame {
+		st.lastSent = now
+	}
+	st.s.FramesSent++
+	st.s.BytesSent += int64(size)
+	st.s.AudioSent += d
+}
+
+// receive 记录一条结果, 是首个结果时返回首帧发送到此刻的耗时
+func (st *sessionStats) receive(msg []byte) (ttfr time.Duration) {
+	now := time.Now()
+	status, hasStatus := peekStatus(msg)
+	_, _, sid, _ := peekCode(msg)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.s.FramesReceived++
+	st.s.BytesReceived += int64(len(msg))
+	if st.s.Sid == "" {
+		st.s.Sid = sid
+	}
+
+	if st.firstRecv.IsZero() && !st.firstSent.IsZero() {
+		st.firstRecv = now
+		st.s.TimeToFirstResponse = now.Sub(st.firstSent)
+		ttfr = st.s.TimeToFirstResponse
+	}
+
+	if hasStatus && status == StatusLastFrame && st.finalRecv.IsZero() {
+		st.finalRecv = now
+		if !st.lastSent.IsZero() {
+			st.s.FinalLatency = now.Sub(st.lastSent)
+		}
+	}
+
+	return
+}
+
+func (st *sessionStats) snapshot() StreamStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	s := st.s
+	if !st.firstSent.IsZero() && s.AudioSent > 0 {
+		end := st.finalRecv
+		if end.IsZero() {
+			end = time.Now()
+		}
+		s.RealTimeFactor = end.Sub(st.firstSent).Seconds() / s.AudioSent.Seconds()
+	}
+
+	return s
+}
@@ -0,0 +1,269 @@
+package ase
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/iflytek/ase-sdk-go"
+
+// WithTracerProvider 设置链路追踪, 默认使用 otel 的全局 TracerProvider.
+// Once、OnceAIaaS 与每个流式会话各对应一个span, 帧的收发记录为span事件, traceparent 随建连与http请求传递
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *client) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider 设置指标, 默认使用 otel 的全局 MeterProvider.
+// 记录请求延迟、首个结果的延迟、发送的帧数与音频字节数以及按错误码统计的错误数
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *client) {
+		c.meterProvider = mp
+	}
+}
+
+type telemetry struct {
+	tracer      trace.Tracer
+	propagator  propagation.TextMapPropagator
+	latency     metric.Float64Histogram
+	firstResult metric.Float64Histogram
+	frames      metric.Int64Counter
+	bytes       metric.Int64Counter
+	errors      metric.Int64Counter
+}
+
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) *telemetry {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+
+	meter := mp.Meter(instrumentationName)
+	t := &telemetry{
+		tracer:     tp.Tracer(instrumentationName),
+		propagator: otel.GetTextMapPropagator(),
+	}
+
+	// 创建失败时返回的仪表不记录任何数据
+	t.latency, _ = meter.Float64Histogram("ase.client.request.duration",
+		metric.WithUnit("s"), metric.WithDescription("Duration of Once calls"))
+	t.firstResult, _ = meter.Float64Histogram("ase.client.stream.time_to_first_result",
+		metric.WithUnit("s"), metric.WithDescription("Time from the first frame sent to the first result received"))
+	t.frames, _ = meter.Int64Counter("ase.client.stream.frames_sent",
+		metric.WithUnit("{frame}"), metric.WithDescription("Number of frames sent"))
+	t.bytes, _ = meter.Int64Counter("ase.client.stream.bytes_sent",
+		metric.WithUnit("By"), metric.WithDescription("Audio bytes sent in frames"))
+	t.errors, _ = meter.Int64Counter("ase.client.errors",
+		metric.WithUnit("{error}"), metric.WithDescription("Number of errors by code"))
+
+	return t
+}
+
+// streamTrace 流式会话的span
+type streamTrace struct {
+	ctx  context.Context
+	span trace.Span
+	once sync.Once
+
+	mu  sync.Mutex
+	sid string
+}
+
+func (c *client) baseAttrs() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("ase.uri", c.uri),
+		attribute.String("ase.appid", c.appid),
+	}
+}
+
+// traceOnce 为一次 Once 调用创建span, 返回结束span的函数
+func (c *client) traceOnce(ctx context.Context, name string) (context.Context, func(body []byte, err error)) {
+	start := time.Now()
+	ctx, span := c.tel.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(c.baseAttrs()...),
+	)
+
+	return ctx, func(body []byte, err error) {
+		attrs := append(c.baseAttrs(), attribute.String("ase.method", name))
+		if code, _, sid, ok := peekCode(body); ok {
+			span.SetAttributes(attribute.Int("ase.code", code), attribute.String("ase.sid", sid))
+			attrs = append(attrs, attribute.Int("ase.code", code))
+			if code != 0 {
+				c.tel.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+			}
+		}
+		if status, ok := peekStatus(body); ok {
+			span.SetAttributes(attribute.Int("ase.status", status))
+		}
+
+		var ee *EngineError
+		if err != nil {
+			if !errors.As(err, &ee) {
+				// 引擎错误已按错误码计数
+				attrs = append(attrs, errorAttrs(err)...)
+				c.tel.errors.Add(ctx, 1, metric.WithAttributes(attrs...))
+			}
+			c.recordError(span, err)
+			span.SetStatus(codes.Error, c.redactText(err.Error()))
+		}
+
+		c.tel.latency.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		span.End()
+	}
+}
+
+// traceAttempt 记录单次请求实际使用的服务地址
+func traceAttempt(ctx context.Context, host string) {
+	trace.SpanFromContext(ctx).AddEvent("ase.attempt", trace.WithAttributes(attribute.String("server.address", host)))
+}
+
+// traceServer 将成功处理请求或建立连接的服务地址记录到span上, 切换地址或断线重连后随之更新
+func traceServer(ctx context.Context, host string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("server.address", host))
+}
+
+// traceHeader 返回携带 traceparent 的请求头, base 不会被修改
+func (c *client) traceHeader(ctx context.Context, base http.Header) http.Header {
+	header := base.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	c.tel.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+	return header
+}
+
+// startStream 创建流式会话的span
+func (c *client) startStream(ctx context.Context) (context.Context, *streamTrace) {
+	ctx, span := c.tel.tracer.Start(ctx, "ase.Stream",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(c.baseAttrs()...),
+	)
+	// 会话的上下文在建连之后继续用于重连与日志, 不随建连时的ctx取消
+	return ctx, &streamTrace{ctx: context.WithoutCancel(ctx), span: span}
+}
+
+// recordError 将隐藏了签名参数与密钥的错误记录到span上, 原始错误中可能含有带签名的url
+func (c *client) recordError(span trace.Span, err error) {
+	span.RecordError(errors.New(c.redactText(err.Error())))
+}
+
+// streamTrace 返回流式会话的span, 尚未建连时为nil
+func (c *client) streamTrace() *streamTrace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.trace
+}
+
+func (c *client) traceSend(req interface{}, err error) {
+	t := c.streamTrace()
+	if t == nil {
+		return
+	}
+
+	if err != nil {
+		c.recordError(t.span, err)
+		c.tel.errors.Add(t.ctx, 1, metric.WithAttributes(append(c.baseAttrs(), errorAttrs(err)...)...))
+		return
+	}
+
+	status, _, size := frameMeta(req)
+	t.span.AddEvent("ase.send", trace.WithAttributes(
+		attribute.Int("ase.status", status),
+		attribute.Int("ase.audio_bytes", size),
+	))
+
+	attrs := metric.WithAttributes(c.baseAttrs()...)
+	c.tel.frames.Add(t.ctx, 1, attrs)
+	c.tel.bytes.Add(t.ctx, int64(size), attrs)
+}
+
+// traceReceive 记录收到的结果, ttfr 大于0表示这是会话的首个结果
+func (c *client) traceReceive(msg []byte, err error, ttfr time.Duration) {
+	t := c.streamTrace()
+	if t == nil {
+		return
+	}
+
+	if errors.Is(err, io.EOF) {
+		return
+	}
+	if err != nil {
+		c.recordError(t.span, err)
+		c.tel.errors.Add(t.ctx, 1, metric.WithAttributes(append(c.baseAttrs(), errorAttrs(err)...)...))
+		return
+	}
+
+	attrs := []attribute.KeyValue{attribute.Int("ase.bytes", len(msg))}
+	status, hasStatus := peekStatus(msg)
+	if hasStatus {
+		attrs = append(attrs, attribute.Int("ase.status", status))
+	}
+	code, _, sid, hasCode := peekCode(msg)
+	if hasCode {
+		attrs = append(attrs, attribute.Int("ase.code", code))
+	}
+	t.span.AddEvent("ase.receive", trace.WithAttributes(attrs...))
+
+	if hasCode && code != 0 {
+		t.span.SetAttributes(attribute.Int("ase.code", code))
+		t.span.SetStatus(codes.Error, "engine error")
+		c.tel.errors.Add(t.ctx, 1, metric.WithAttributes(append(c.baseAttrs(), attribute.Int("ase.code", code))...))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if sid != "" && t.sid == "" {
+		t.sid = sid
+		t.span.SetAttributes(attribute.String("ase.sid", sid))
+	}
+	if hasStatus {
+		t.span.SetAttributes(attribute.Int("ase.status", status))
+	}
+	if ttfr > 0 {
+		c.tel.firstResult.Record(t.ctx, ttfr.Seconds(), metric.WithAttributes(c.baseAttrs()...))
+	}
+}
+
+// end 结束流式会话的span
+func (t *streamTrace) end() {
+	t.once.Do(func() {
+		t.span.End()
+	})
+}
+
+// errorAttrs 错误的分类属性: http状态码或错误类型
+func errorAttrs(err error) []attribute.KeyValue {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return []attribute.KeyValue{attribute.Int("http.response.status_code", he.StatusCode)}
+	}
+	var ee *EngineError
+	if errors.As(err, &ee) {
+		return []attribute.KeyValue{attribute.Int("ase.code", ee.Code)}
+	}
+	var ce *CloseError
+	if errors.As(err, &ce) {
+		return []attribute.KeyValue{attribute.Int("ase.close_code", ce.Code)}
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return []attribute.KeyValue{attribute.String("error.type", "circuit_open")}
+	}
+	return []attribute.KeyValue{attribute.String("error.type", "transport")}
+}
@@ -0,0 +1,180 @@
+package ase
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingProvider 记录span属性的 TracerProvider
+type recordingProvider struct {
+	embedded.TracerProvider
+
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (p *recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return &recordingTracer{p: p}
+}
+
+func (p *recordingProvider) span(name string) *recordingSpan {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, s := range p.spans {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+type recordingTracer struct {
+	embedded.Tracer
+	p *recordingProvider
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &recordingSpan{name: name, attrs: make(map[attribute.Key]attribute.Value)}
+	cfg := trace.NewSpanStartConfig(opts...)
+	s.SetAttributes(cfg.Attributes()...)
+
+	t.p.mu.Lock()
+	t.p.spans = append(t.p.spans, s)
+	t.p.mu.Unlock()
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type recordingSpan struct {
+	noop.Span
+	name string
+
+	mu    sync.Mutex
+	attrs map[attribute.Key]attribute.Value
+	errs  []string
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.errs = append(s.errs, err.Error())
+}
+
+func (s *recordingSpan) errors() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.errs...)
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) attr(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.attrs[attribute.Key(key)].Emit()
+}
+
+// 不可用的地址, 连接会被拒绝
+const deadHost = "127.0.0.1:1"
+
+func TestStreamSpanServerAddress(t *testing.T) {
+	s := newTestServer(t, drain)
+	tp := &recordingProvider{}
+
+	c := newTestClient(t, s, "/span-host", WithTracerProvider(tp),
+		WithHosts(Endpoint{Host: deadHost, Priority: 0}, Endpoint{Host: s.host, Priority: 1}))
+	defer c.Destroy()
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	span := tp.span("ase.Stream")
+	if span == nil {
+		t.Fatal("no stream span")
+	}
+	if got := span.attr("server.address"); got != s.host {
+		t.Fatalf("server.address = %q, want %q", got, s.host)
+	}
+}
+
+func TestOnceSpanServerAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"header":{"code":0,"status":3}}`))
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	tp := &recordingProvider{}
+	cli, err := NewClient("appid", "key", "secret", host, "/once-host", WithTracerProvider(tp),
+		WithHosts(Endpoint{Host: deadHost, Priority: 0}, Endpoint{Host: host, Priority: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cli.Once(&Request{Header: RequestHeader{"status": StatusForOnce}}); err != nil {
+		t.Fatal(err)
+	}
+
+	span := tp.span("ase.Once")
+	if span == nil {
+		t.Fatal("no Once span")
+	}
+	if got := span.attr("server.address"); got != host {
+		t.Fatalf("server.address = %q, want %q", got, host)
+	}
+}
+
+// span上记录的错误不能含有可重放的签名参数
+func TestSpanErrorRedacted(t *testing.T) {
+	tp := &recordingProvider{}
+	cli, err := NewClient("appid", "key", "secret", deadHost, "/span-error", WithTracerProvider(tp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = cli.Once(&Request{Header: RequestHeader{"status": StatusForOnce}}); err == nil {
+		t.Fatal("Once to a dead host succeeded")
+	}
+	if !strings.Contains(err.Error(), "authorization=") {
+		t.Fatalf("error %q does not carry the signed url, the test no longer covers redaction", err)
+	}
+	if err = cli.(Connector).Connect(context.Background()); err == nil {
+		t.Fatal("Connect to a dead host succeeded")
+	}
+
+	for _, name := range []string{"ase.Once", "ase.Stream"} {
+		span := tp.span(name)
+		if span == nil {
+			t.Fatalf("no %s span", name)
+		}
+		errs := span.errors()
+		if len(errs) == 0 {
+			t.Fatalf("%s: no error recorded", name)
+		}
+		for _, e := range errs {
+			if strings.Contains(e, "authorization=") && !strings.Contains(e, "authorization="+redacted) {
+				t.Fatalf("%s: recorded error %q leaks the signature", name, e)
+			}
+		}
+	}
+}
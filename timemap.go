@@ -0,0 +1,53 @@
+package ase
+
+import (
+	"sync"
+	"time"
+)
+
+// sourceFrame 来源读取的一帧音频
+type sourceFrame struct {
+	data     []byte
+	pos      time.Duration // 在源音频中的位置
+	injected bool          // 源音频中不存在的静音帧
+}
+
+// timeMark 从已发送音频的at处开始, 源音频的时间比已发送音频晚offset
+type timeMark struct {
+	at     time.Duration
+	offset time.Duration
+}
+
+// timeMap 记录已发送音频与源音频的时间对应关系, 用于还原跳过或插入音频后的结果时间戳
+type timeMap struct {
+	mu    sync.Mutex
+	sent  time.Duration // 已发送音频的时长
+	marks []timeMark
+}
+
+// record 记录发送了源音频中pos处时长为d的音频
+func (m *timeMap) record(pos, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	offset := pos - m.sent
+	if n := len(m.marks); n == 0 || m.marks[n-1].offset != offset {
+		m.marks = append(m.marks, timeMark{at: m.sent, offset: offset})
+	}
+	m.sent += d
+}
+
+// offsetAt 返回已发送音频中t时刻对应的源音频偏移
+func (m *timeMap) offsetAt(t time.Duration) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var offset time.Duration
+	for _, mark := range m.marks {
+		if mark.at > t {
+			break
+		}
+		offset = mark.offset
+	}
+	return offset
+}
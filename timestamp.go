@@ -0,0 +1,218 @@
+package ase
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// Segment 识别结果所覆盖的音频区间
+type Segment struct {
+	Begin time.Duration
+	End   time.Duration
+	Final bool // 该片段是否已确定, 不会再被后续结果修改
+}
+
+// TimestampCodec 解析并平移识别结果中的时间戳
+type TimestampCodec interface {
+	// Segment 解析结果覆盖的音频区间, 结果中不含时间戳时ok为false
+	Segment(msg []byte) (seg Segment, ok bool, err error)
+	// Shift 将结果中的时间戳整体平移offset
+	Shift(msg []byte, offset time.Duration) ([]byte, error)
+}
+
+// SegmentShifter 由可以分别平移起止时间的 TimestampCodec 实现, 用于还原跳过了部分音频的结果时间戳.
+// 未实现时起止时间都按起始时间的偏移平移
+type SegmentShifter interface {
+	// ShiftSegment 将结果的起始时间平移begin, 结束时间平移end
+	ShiftSegment(msg []byte, begin, end time.Duration) ([]byte, error)
+}
+
+// ASETimestampCodec 解析ASE协议的结果, 时间戳位于 payload.<PayloadKey>.text 经base64解码后的 bg/ed 字段
+type ASETimestampCodec struct {
+	PayloadKey string        // 默认 result
+	Unit       time.Duration // bg/ed 的时间单位, 默认毫秒
+}
+
+func (c ASETimestampCodec) Segment(msg []byte) (seg Segment, ok bool, err error) {
+	var resp struct {
+		Payload map[string]struct {
+			Text string `json:"text"`
+		} `json:"payload"`
+	}
+	if err = json.Unmarshal(msg, &resp); err != nil {
+		return
+	}
+
+	result, found := resp.Payload[c.payloadKey()]
+	if !found || result.Text == "" {
+		return
+	}
+
+	text, err := base64.StdEncoding.DecodeString(result.Text)
+	if err != nil {
+		return
+	}
+
+	return parseSegment(text, unitOr(c.Unit))
+}
+
+func (c ASETimestampCodec) Shift(msg []byte, offset time.Duration) ([]byte, error) {
+	return c.ShiftSegment(msg, offset, offset)
+}
+
+func (c ASETimestampCodec) ShiftSegment(msg []byte, begin, end time.Duration) ([]byte, error) {
+	bg, ed := int64(begin/unitOr(c.Unit)), int64(end/unitOr(c.Unit))
+	if bg == 0 && ed == 0 {
+		return msg, nil
+	}
+
+	doc, err := decodeDoc(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, _ := doc["payload"].(map[string]interface{})
+	result, _ := payload[c.payloadKey()].(map[string]interface{})
+	text, _ := result["text"].(string)
+	if text == "" {
+		return msg, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, err
+	}
+
+	textDoc, err := decodeDoc(raw)
+	if err != nil {
+		return nil, err
+	}
+	if !shiftFields(textDoc, bg, ed) {
+		return msg, nil
+	}
+
+	if raw, err = json.Marshal(textDoc); err != nil {
+		return nil, err
+	}
+	result["text"] = base64.StdEncoding.EncodeToString(raw)
+
+	return json.Marshal(doc)
+}
+
+func (c ASETimestampCodec) payloadKey() string {
+	if c.PayloadKey == "" {
+		return "result"
+	}
+	return c.PayloadKey
+}
+
+// AIaaSTimestampCodec 解析AIaaS协议的结果, 时间戳位于 data.result 的 bg/ed 字段
+type AIaaSTimestampCodec struct {
+	Unit time.Duration // bg/ed 的时间单位, 默认毫秒
+}
+
+func (c AIaaSTimestampCodec) Segment(msg []byte) (seg Segment, ok bool, err error) {
+	var resp struct {
+		Data struct {
+			Result json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err = json.Unmarshal(msg, &resp); err != nil {
+		return
+	}
+
+	if len(resp.Data.Result) == 0 {
+		return
+	}
+
+	return parseSegment(resp.Data.Result, unitOr(c.Unit))
+}
+
+func (c AIaaSTimestampCodec) Shift(msg []byte, offset time.Duration) ([]byte, error) {
+	return c.ShiftSegment(msg, offset, offset)
+}
+
+func (c AIaaSTimestampCodec) ShiftSegment(msg []byte, begin, end time.Duration) ([]byte, error) {
+	bg, ed := int64(begin/unitOr(c.Unit)), int64(end/unitOr(c.Unit))
+	if bg == 0 && ed == 0 {
+		return msg, nil
+	}
+
+	doc, err := decodeDoc(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	data, _ := doc["data"].(map[string]interface{})
+	result, _ := data["result"].(map[string]interface{})
+	if !shiftFields(result, bg, ed) {
+		return msg, nil
+	}
+
+	return json.Marshal(doc)
+}
+
+// parseSegment 解析结果中的 bg/ed 字段.
+// 含 sub_end 字段时以其判断片段是否确定; 开启动态修正(含 pgs 字段)时仅最后一个结果(ls)是确定的.
+func parseSegment(text []byte, unit time.Duration) (seg Segment, ok bool, err error) {
+	var r struct {
+		Bg     *int64  `json:"bg"`
+		Ed     *int64  `json:"ed"`
+		Ls     bool    `json:"ls"`
+		SubEnd *bool   `json:"sub_end"`
+		Pgs    *string `json:"pgs"`
+	}
+	if err = json.Unmarshal(text, &r); err != nil {
+		return
+	}
+
+	if r.Bg == nil || r.Ed == nil {
+		return
+	}
+
+	seg.Begin = time.Duration(*r.Bg) * unit
+	seg.End = time.Duration(*r.Ed) * unit
+	switch {
+	case r.SubEnd != nil:
+		seg.Final = *r.SubEnd || r.Ls
+	case r.Pgs != nil:
+		seg.Final = r.Ls
+	default:
+		seg.Final = true
+	}
+
+	return seg, true, nil
+}
+
+// shiftFields 将 bg 平移bg, ed 平移ed
+func shiftFields(m map[string]interface{}, bg, ed int64) (shifted bool) {
+	for key, delta := range map[string]int64{"bg": bg, "ed": ed} {
+		n, ok := m[key].(json.Number)
+		if !ok {
+			continue
+		}
+		v, err := n.Int64()
+		if err != nil {
+			continue
+		}
+		m[key] = v + delta
+		shifted = true
+	}
+	return
+}
+
+func decodeDoc(b []byte) (doc map[string]interface{}, err error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	err = dec.Decode(&doc)
+	return
+}
+
+func unitOr(unit time.Duration) time.Duration {
+	if unit <= 0 {
+		return time.Millisecond
+	}
+	return unit
+}
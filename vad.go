@@ -0,0 +1,119 @@
+package ase
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	defaultVADPreroll      = 200 * time.Millisecond
+	defaultVADZeroCrossing = 0.25
+)
+
+// VADConfig 基于能量与过零率的语音检测配置, 见 AudioSourceConfig.VAD. 仅支持pcm音频
+type VADConfig struct {
+	// Threshold 语音的电平阈值, 按满量程归一化, 默认0.01
+	Threshold float64
+	// ZeroCrossing 过零率阈值, 电平不低于 Threshold 的一半且过零率不低于该值的帧判定为清音, 默认0.25
+	ZeroCrossing float64
+	// Preroll 语音开始前保留的静音, 默认200ms
+	Preroll time.Duration
+	// MaxSilence 语音中的静音超过该时长后跳过其余部分, 为0时不跳过
+	MaxSilence time.Duration
+	// EndSilence 语音之后的静音达到该时长时结束会话(发送尾帧), 为0时读取到音频结尾
+	EndSilence time.Duration
+}
+
+// vad 过滤音频帧: 去掉开头的静音, 跳过过长的静音, 检测语音结束
+type vad struct {
+	cfg    VADConfig
+	format AudioFormat
+
+	pos     time.Duration // 下一个输入帧在源音频中的位置
+	started bool          // 已检测到语音
+	silence time.Duration // 连续静音的时长
+	preroll []sourceFrame
+}
+
+func newVAD(cfg VADConfig, format AudioFormat) *vad {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = defaultSilenceThreshold
+	}
+	if cfg.ZeroCrossing <= 0 {
+		cfg.ZeroCrossing = defaultVADZeroCrossing
+	}
+	if cfg.Preroll <= 0 {
+		cfg.Preroll = defaultVADPreroll
+	}
+	return &vad{cfg: cfg, format: format}
+}
+
+// push 处理一个输入帧, 返回需要发送的帧; end 为true时语音已结束
+func (v *vad) push(frame []byte) (out []sourceFrame, end bool) {
+	d := v.format.Duration(len(frame))
+	f := sourceFrame{data: frame, pos: v.pos}
+	v.pos += d
+
+	if v.isSpeech(frame) {
+		v.started = true
+		v.silence = 0
+		out = append(v.preroll, f)
+		v.preroll = nil
+		return out, false
+	}
+
+	v.silence += d
+	switch {
+	case !v.started:
+	case v.cfg.EndSilence > 0 && v.silence >= v.cfg.EndSilence:
+		return nil, true
+	case v.cfg.MaxSilence <= 0 || v.silence <= v.cfg.MaxSilence:
+		return []sourceFrame{f}, false
+	}
+
+	// 开头或过长的静音只保留最近的 Preroll
+	v.preroll = append(v.preroll, f)
+	var kept time.Duration
+	for i := len(v.preroll) - 1; i >= 0; i-- {
+		kept += v.format.Duration(len(v.preroll[i].data))
+		if kept > v.cfg.Preroll {
+			v.preroll = append(v.preroll[:0], v.preroll[i+1:]...)
+			break
+		}
+	}
+	return nil, false
+}
+
+// isSpeech 电平达到阈值, 或电平稍低但过零率较高(清音)的帧判定为语音
+func (v *vad) isSpeech(frame []byte) bool {
+	level := pcmLevel(frame, v.format)
+	if level >= v.cfg.Threshold {
+		return true
+	}
+	return level >= v.cfg.Threshold/2 && zeroCrossingRate(frame, v.format) >= v.cfg.ZeroCrossing
+}
+
+// zeroCrossingRate 计算第一个声道相邻采样符号变化的比例
+func zeroCrossingRate(pcm []byte, f AudioFormat) float64 {
+	width := f.BitDepth / 8
+	block := width * f.Channels
+	if width <= 0 || block <= 0 {
+		return 0
+	}
+
+	n := len(pcm) / block
+	if n < 2 {
+		return 0
+	}
+
+	crossings := 0
+	prev := pcmSample(pcm, width)
+	for i := 1; i < n; i++ {
+		cur := pcmSample(pcm[i*block:], width)
+		if math.Signbit(cur) != math.Signbit(prev) {
+			crossings++
+		}
+		prev = cur
+	}
+	return float64(crossings) / float64(n-1)
+}
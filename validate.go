@@ -0,0 +1,139 @@
+package ase
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidFrame 流式请求帧不符合会话状态, 帧未被发送
+var ErrInvalidFrame = errors.New("invalid stream frame")
+
+// WithStreamValidation 发送前校验流式请求帧, 默认开启:
+// 首帧状态须为 StatusFirstFrame 且携带服务参数, 尾帧(StatusLastFrame)之后不能再发送;
+// 各payload的状态须以 StatusFirstFrame 开始, 非0的 seq 须递增.
+// 校验失败时返回包装了 ErrInvalidFrame 的错误
+func WithStreamValidation(enable bool) Option {
+	return func(c *client) {
+		c.skipValidation = !enable
+	}
+}
+
+// frameState 流式会话的帧状态, 由 sendMu 保护
+type frameState struct {
+	started bool
+	ended   bool
+	keys    map[string]*payloadState
+}
+
+type payloadState struct {
+	ended bool
+	seq   int
+}
+
+// check 校验一帧, 返回记录该帧的函数, 帧发送成功后调用; 校验失败或帧未发送时会话状态不变
+func (s *frameState) check(req interface{}) (commit func(), err error) {
+	status := frameStatus(req)
+	if err = s.checkStatus(req, status); err != nil {
+		return nil, err
+	}
+
+	next := make(map[string]payloadState)
+	if r, ok := req.(*Request); ok {
+		for k, p := range r.Payload {
+			st, err := s.checkPayload(k, p)
+			if err != nil {
+				return nil, err
+			}
+			next[k] = st
+		}
+	}
+
+	return func() {
+		s.started = true
+		s.ended = status == StatusLastFrame || status == StatusForOnce
+		if s.keys == nil {
+			s.keys = make(map[string]*payloadState)
+		}
+		for k, st := range next {
+			st := st
+			s.keys[k] = &st
+		}
+	}, nil
+}
+
+func (s *frameState) checkStatus(req interface{}, status int) error {
+	switch {
+	case s.ended:
+		return fmt.Errorf("%w: status %d sent after the last frame", ErrInvalidFrame, status)
+	case status < StatusFirstFrame || status > StatusForOnce:
+		return fmt.Errorf("%w: unknown status %d", ErrInvalidFrame, status)
+	case !s.started && status != StatusFirstFrame && status != StatusForOnce:
+		return fmt.Errorf("%w: first frame has status %d, want StatusFirstFrame", ErrInvalidFrame, status)
+	case s.started && (status == StatusFirstFrame || status == StatusForOnce):
+		return fmt.Errorf("%w: status %d sent after the first frame", ErrInvalidFrame, status)
+	}
+
+	if s.started {
+		return nil
+	}
+
+	switch r := req.(type) {
+	case *Request:
+		if len(r.Parameter) == 0 {
+			return fmt.Errorf("%w: first frame has no parameter", ErrInvalidFrame)
+		}
+	case *AIaaSRequest:
+		if len(r.Business) == 0 {
+			return fmt.Errorf("%w: first frame has no business parameter", ErrInvalidFrame)
+		}
+	}
+	return nil
+}
+
+func (s *frameState) checkPayload(key string, p interface{}) (payloadState, error) {
+	var st payloadState
+	if prev := s.keys[key]; prev != nil {
+		st = *prev
+	}
+
+	status, ok := payloadStatus(p)
+	if !ok {
+		return st, nil
+	}
+
+	_, seen := s.keys[key]
+	switch {
+	case st.ended:
+		return st, fmt.Errorf("%w: payload %q sent after its last frame", ErrInvalidFrame, key)
+	case !seen && status != StatusFirstFrame && status != StatusForOnce:
+		return st, fmt.Errorf("%w: payload %q starts with status %d, want StatusFirstFrame", ErrInvalidFrame, key, status)
+	case seen && (status == StatusFirstFrame || status == StatusForOnce):
+		return st, fmt.Errorf("%w: payload %q has status %d after its first frame", ErrInvalidFrame, key, status)
+	}
+
+	// seq 为0时视为未编号
+	if seq := payloadSeq(p); seq != 0 {
+		if seq <= st.seq {
+			return st, fmt.Errorf("%w: payload %q seq %d is not after %d", ErrInvalidFrame, key, seq, st.seq)
+		}
+		st.seq = seq
+	}
+	st.ended = status == StatusLastFrame || status == StatusForOnce
+	return st, nil
+}
+
+// payloadStatus 读取payload的状态
+func payloadStatus(p interface{}) (int, bool) {
+	switch v := p.(type) {
+	case *AudioPayload:
+		return v.Status, true
+	case *TextPayload:
+		return v.Status, true
+	case *ImagePayload:
+		return v.Status, true
+	case map[string]interface{}:
+		s, ok := v["status"]
+		return toInt(s), ok
+	}
+	return 0, false
+}
@@ -0,0 +1,147 @@
+package ase
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFrameStateCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []*Request
+		valid  []bool
+	}{
+		{
+			name:   "normal",
+			frames: []*Request{testFrame(StatusFirstFrame, 1, nil), testFrame(StatusContinue, 2, nil), testFrame(StatusLastFrame, 3, nil)},
+			valid:  []bool{true, true, true},
+		},
+		{
+			name:   "first frame is not StatusFirstFrame",
+			frames: []*Request{testFrame(StatusContinue, 1, nil)},
+			valid:  []bool{false},
+		},
+		{
+			name:   "first frame without parameter",
+			frames: []*Request{{Header: RequestHeader{"status": StatusFirstFrame}}},
+			valid:  []bool{false},
+		},
+		{
+			name:   "after the last frame",
+			frames: []*Request{testFrame(StatusFirstFrame, 1, nil), testFrame(StatusLastFrame, 2, nil), testFrame(StatusContinue, 3, nil)},
+			valid:  []bool{true, true, false},
+		},
+		{
+			name:   "seq not increasing",
+			frames: []*Request{testFrame(StatusFirstFrame, 1, nil), testFrame(StatusContinue, 3, nil), testFrame(StatusContinue, 2, nil), testFrame(StatusContinue, 4, nil)},
+			valid:  []bool{true, true, false, true},
+		},
+		{
+			name:   "unnumbered frames",
+			frames: []*Request{testFrame(StatusFirstFrame, 0, nil), testFrame(StatusContinue, 0, nil), testFrame(StatusContinue, 0, nil)},
+			valid:  []bool{true, true, true},
+		},
+		{
+			name:   "second first frame",
+			frames: []*Request{testFrame(StatusFirstFrame, 1, nil), testFrame(StatusFirstFrame, 2, nil)},
+			valid:  []bool{true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s frameState
+			for i, req := range tt.frames {
+				commit, err := s.check(req)
+				if (err == nil) != tt.valid[i] {
+					t.Fatalf("frame %d: got err %v, want valid=%v", i, err, tt.valid[i])
+				}
+				if err != nil {
+					if !errors.Is(err, ErrInvalidFrame) {
+						t.Fatalf("frame %d: %v does not wrap ErrInvalidFrame", i, err)
+					}
+					continue
+				}
+				commit()
+			}
+		})
+	}
+}
+
+// 帧未发送成功时不记录状态, 重发同一帧仍然有效
+func TestFrameStateUncommitted(t *testing.T) {
+	var s frameState
+	if _, err := s.check(testFrame(StatusFirstFrame, 1, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := s.check(testFrame(StatusFirstFrame, 1, nil))
+	if err != nil {
+		t.Fatalf("unsent first frame was recorded: %v", err)
+	}
+	commit()
+
+	if _, err = s.check(testFrame(StatusFirstFrame, 1, nil)); err == nil {
+		t.Fatal("first frame accepted twice")
+	}
+}
+
+// 并发 Send 时通过校验的帧按seq顺序到达服务端
+func TestConcurrentSendKeepsSeqOrder(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seqs []int
+	)
+	done := make(chan struct{})
+	s := newTestServer(t, func(conn *websocket.Conn) {
+		defer close(done)
+		for {
+			var req struct {
+				Payload map[string]AudioPayload `json:"payload"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			mu.Lock()
+			seqs = append(seqs, req.Payload["audio"].Seq)
+			mu.Unlock()
+		}
+	})
+
+	c := newTestClient(t, s, "/seq-order")
+	if err := c.Send(testFrame(StatusFirstFrame, 1, make([]byte, 64))); err != nil {
+		t.Fatal(err)
+	}
+
+	var next atomic.Int64
+	next.Store(1)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				err := c.Send(testFrame(StatusContinue, int(next.Add(1)), make([]byte, 64)))
+				if err != nil && !errors.Is(err, ErrInvalidFrame) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	_ = c.Destroy()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] <= seqs[i-1] {
+			t.Fatalf("frame %d has seq %d after %d", i, seqs[i], seqs[i-1])
+		}
+	}
+}
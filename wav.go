@@ -0,0 +1,141 @@
+package ase
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnsupportedFormat 音频格式不受支持
+var ErrUnsupportedFormat = errors.New("unsupported audio format")
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatALaw       = 6
+	wavFormatMuLaw      = 7
+	wavFormatExtensible = 0xFFFE
+)
+
+// NewWAVSource 创建读取RIFF/WAV文件或流的音频来源, 音频格式取自fmt块, 只发送data块中的音频.
+// cfg.Format 被忽略; 支持8/16/24/32位pcm, 以及需要通过 cfg.Target 转换的浮点与G.711音频,
+// 头部损坏、格式不受支持或未设置所需的 cfg.Target 时返回 ErrUnsupportedFormat
+func NewWAVSource(r io.Reader, cfg AudioSourceConfig) (*AudioSource, error) {
+	format, data, err := readWAV(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Format = format
+	s := NewAudioSource(data, cfg)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s, nil
+}
+
+// readWAV 解析wav头部, 返回音频格式与data块的reader
+func readWAV(r io.Reader) (format AudioFormat, data io.Reader, err error) {
+	var riff [12]byte
+	if _, err = io.ReadFull(r, riff[:]); err != nil {
+		return format, nil, fmt.Errorf("read wav header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return format, nil, fmt.Errorf("%w: not a RIFF/WAVE stream", ErrUnsupportedFormat)
+	}
+
+	hasFmt := false
+	for {
+		var hdr [8]byte
+		if _, err = io.ReadFull(r, hdr[:]); err != nil {
+			return format, nil, fmt.Errorf("read wav chunk: %w", err)
+		}
+		id, size := string(hdr[0:4]), binary.LittleEndian.Uint32(hdr[4:8])
+
+		switch id {
+		case "fmt ":
+			if format, err = readWAVFormat(r, size); err != nil {
+				return format, nil, err
+			}
+			hasFmt = true
+		case "data":
+			if !hasFmt {
+				return format, nil, fmt.Errorf("%w: wav data chunk before fmt chunk", ErrUnsupportedFormat)
+			}
+			// 流式写入的wav中data块大小可能为0或0xFFFFFFFF, 此时读取到结尾
+			if size == 0 || size == 0xFFFFFFFF {
+				return format, r, nil
+			}
+			return format, io.LimitReader(r, int64(size)), nil
+		default:
+			if err = skipChunk(r, size); err != nil {
+				return format, nil, fmt.Errorf("skip wav chunk %q: %w", id, err)
+			}
+		}
+	}
+}
+
+// maxWAVFormatSize fmt块的大小上限, WAVE_FORMAT_EXTENSIBLE 为40字节, 更大的块只可能是损坏的头部
+const maxWAVFormatSize = 64
+
+func readWAVFormat(r io.Reader, size uint32) (format AudioFormat, err error) {
+	if size < 16 {
+		return format, fmt.Errorf("%w: wav fmt chunk too short (%d bytes)", ErrUnsupportedFormat, size)
+	}
+	if size > maxWAVFormatSize {
+		return format, fmt.Errorf("%w: wav fmt chunk too long (%d bytes)", ErrUnsupportedFormat, size)
+	}
+
+	// 只读取用到的前40字节, 其余部分连同对齐字节一起跳过
+	n := size
+	if n > 40 {
+		n = 40
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return format, fmt.Errorf("read wav fmt chunk: %w", err)
+	}
+	if _, err = io.CopyN(io.Discard, r, int64(size-n)+int64(size%2)); err != nil {
+		return format, fmt.Errorf("read wav fmt chunk: %w", err)
+	}
+
+	tag := binary.LittleEndian.Uint16(b[0:2])
+	format = AudioFormat{
+		Encoding:   EncodingRaw,
+		Channels:   int(binary.LittleEndian.Uint16(b[2:4])),
+		SampleRate: int(binary.LittleEndian.Uint32(b[4:8])),
+		BitDepth:   int(binary.LittleEndian.Uint16(b[14:16])),
+	}
+
+	// WAVE_FORMAT_EXTENSIBLE 的实际格式位于子格式GUID的前两个字节
+	if tag == wavFormatExtensible {
+		if size < 40 {
+			return format, fmt.Errorf("%w: wav extensible fmt chunk too short (%d bytes)", ErrUnsupportedFormat, size)
+		}
+		tag = binary.LittleEndian.Uint16(b[24:26])
+	}
+
+	switch tag {
+	case wavFormatPCM:
+	case wavFormatFloat:
+		format.Encoding = EncodingFloat
+	case wavFormatALaw:
+		format.Encoding = EncodingALaw
+	case wavFormatMuLaw:
+		format.Encoding = EncodingMuLaw
+	default:
+		return format, fmt.Errorf("%w: wav format tag %#x", ErrUnsupportedFormat, tag)
+	}
+
+	if err = checkSampleFormat(format); err != nil {
+		return format, fmt.Errorf("wav: %w", err)
+	}
+	return format, nil
+}
+
+// skipChunk 跳过一个块, 块按2字节对齐
+func skipChunk(r io.Reader, size uint32) error {
+	_, err := io.CopyN(io.Discard, r, int64(size)+int64(size%2))
+	return err
+}
@@ -0,0 +1,86 @@
+package ase
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// wavChunk 一个wav块, 大小字段为size
+func wavChunk(id string, size uint32, body []byte) []byte {
+	b := make([]byte, 8, 8+len(body))
+	copy(b, id)
+	binary.LittleEndian.PutUint32(b[4:], size)
+	return append(b, body...)
+}
+
+// wavFmt fmt块的内容
+func wavFmt(tag, channels uint16, rate uint32, bits uint16) []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b[0:], tag)
+	binary.LittleEndian.PutUint16(b[2:], channels)
+	binary.LittleEndian.PutUint32(b[4:], rate)
+	binary.LittleEndian.PutUint16(b[14:], bits)
+	return b
+}
+
+func wavFile(chunks ...[]byte) []byte {
+	return append([]byte("RIFF\x00\x00\x00\x00WAVE"), bytes.Join(chunks, nil)...)
+}
+
+func TestNewWAVSource(t *testing.T) {
+	pcm := wavFmt(wavFormatPCM, 1, 16000, 16)
+	audio := make([]byte, 3200)
+	odd := append(append([]byte{}, pcm...), 0) // 17字节的fmt块带1字节对齐
+
+	tests := []struct {
+		name  string
+		input []byte
+		cfg   AudioSourceConfig
+		err   error
+	}{
+		{"pcm", wavFile(wavChunk("fmt ", 16, pcm), wavChunk("data", 3200, audio)), AudioSourceConfig{}, nil},
+		{"other chunks", wavFile(wavChunk("LIST", 3, []byte{1, 2, 3, 0}), wavChunk("fmt ", 16, pcm), wavChunk("data", 0, audio)), AudioSourceConfig{}, nil},
+		{"odd fmt chunk", wavFile(wavChunk("fmt ", 17, append(odd, 0)), wavChunk("data", 3200, audio)), AudioSourceConfig{}, nil},
+		{"mulaw with target", wavFile(wavChunk("fmt ", 16, wavFmt(wavFormatMuLaw, 1, 8000, 8)), wavChunk("data", 3200, audio)), AudioSourceConfig{Target: pcm16k}, nil},
+		{"not riff", append([]byte("RIFX\x00\x00\x00\x00WAVE"), wavChunk("fmt ", 16, pcm)...), AudioSourceConfig{}, ErrUnsupportedFormat},
+		{"truncated header", []byte("RIFF\x00\x00"), AudioSourceConfig{}, io.ErrUnexpectedEOF},
+		{"fmt chunk too short", wavFile(wavChunk("fmt ", 8, pcm[:8])), AudioSourceConfig{}, ErrUnsupportedFormat},
+		{"fmt chunk too long", wavFile(wavChunk("fmt ", 0xFFFFFFFF, pcm)), AudioSourceConfig{}, ErrUnsupportedFormat},
+		{"truncated fmt chunk", wavFile(wavChunk("fmt ", 16, pcm[:10])), AudioSourceConfig{}, io.ErrUnexpectedEOF},
+		{"short extensible", wavFile(wavChunk("fmt ", 16, wavFmt(wavFormatExtensible, 1, 16000, 16))), AudioSourceConfig{}, ErrUnsupportedFormat},
+		{"unknown tag", wavFile(wavChunk("fmt ", 16, wavFmt(0x55, 1, 16000, 16))), AudioSourceConfig{}, ErrUnsupportedFormat},
+		{"data before fmt", wavFile(wavChunk("data", 3200, audio)), AudioSourceConfig{}, ErrUnsupportedFormat},
+		{"no data chunk", wavFile(wavChunk("fmt ", 16, pcm)), AudioSourceConfig{}, io.EOF},
+		{"oversized chunk", wavFile(wavChunk("LIST", 0xFFFFFFFF, nil)), AudioSourceConfig{}, io.EOF},
+		{"mulaw without target", wavFile(wavChunk("fmt ", 16, wavFmt(wavFormatMuLaw, 1, 8000, 8)), wavChunk("data", 3200, audio)), AudioSourceConfig{}, ErrUnsupportedFormat},
+		{"float without target", wavFile(wavChunk("fmt ", 16, wavFmt(wavFormatFloat, 1, 16000, 32)), wavChunk("data", 3200, audio)), AudioSourceConfig{}, ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewWAVSource(bytes.NewReader(tt.input), tt.cfg)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			// 块对齐错误时data块之后的内容会被当作音频或读不到data块
+			if _, err = s.Next(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if s.cfg.Format.SampleRate != 16000 || s.cfg.Format.Encoding != EncodingRaw {
+				t.Fatalf("format = %+v", s.cfg.Format)
+			}
+		})
+	}
+}